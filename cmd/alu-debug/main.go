@@ -0,0 +1,207 @@
+// alu-debug is an interactive debugger for ALU programs.
+//
+// Usage:
+//
+//	alu-debug [-digits 13579] [-input "1 -2 300"] program.txt
+//
+// The program reads its input from either the digits or the input flag.
+// Debugger commands are read from standard input; type 'help' for a list.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nealmcc/aoc2021/pkg/alu"
+)
+
+func main() {
+	digits := flag.String("digits", "", "input values, one decimal digit each")
+	input := flag.String("input", "", "input values, as whitespace-separated integers")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: alu-debug [-digits 13579] [-input \"1 -2 300\"] program.txt")
+		os.Exit(2)
+	}
+
+	src, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code, err := alu.Compile(src)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	in := alu.Text(strings.NewReader(*input))
+	if *digits != "" {
+		in = alu.Digits(*digits)
+	}
+
+	debug(alu.NewDebugger(code, in), os.Stdin, os.Stdout)
+}
+
+const help = `commands:
+  s, step [n]       execute the next n instructions (default 1)
+  back [n]          undo the last n instructions (default 1)
+  c, continue       run until a breakpoint, watchpoint, error or the end
+  b, break <line>   stop before the instruction on the given line
+  delete <line>     remove the breakpoint from the given line
+  watch <reg>       stop whenever the given register changes
+  unwatch <reg>     remove the watchpoint from the given register
+  r, regs           show the registers
+  l, list           show the program
+  q, quit           exit the debugger
+`
+
+// debug reads commands from r, and writes the results to w, until the user
+// quits or r is exhausted.
+func debug(d *alu.Debugger, r io.Reader, w io.Writer) {
+	show(d, w)
+
+	s := bufio.NewScanner(r)
+	for fmt.Fprint(w, "(alu) "); s.Scan(); fmt.Fprint(w, "(alu) ") {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+
+		if cmd == "q" || cmd == "quit" {
+			return
+		}
+		if err := command(d, w, cmd, args); err != nil {
+			fmt.Fprintln(w, "error:", err)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// command executes a single debugger command.
+func command(d *alu.Debugger, w io.Writer, cmd string, args []string) error {
+	switch cmd {
+	case "s", "step", "back":
+		n, err := optionalCount(args)
+		if err != nil {
+			return err
+		}
+		move := d.Step
+		if cmd == "back" {
+			move = d.StepBack
+		}
+		for i := 0; i < n; i++ {
+			if err := move(); err != nil {
+				show(d, w)
+				return err
+			}
+		}
+		show(d, w)
+
+	case "c", "continue":
+		reason, err := d.Continue()
+		fmt.Fprintf(w, "stopped: %s\n", reason)
+		show(d, w)
+		return err
+
+	case "b", "break", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs a line number", cmd)
+		}
+		line, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid line number %q", args[0])
+		}
+		if cmd == "delete" {
+			d.ClearBreakpoint(line)
+			return nil
+		}
+		return d.SetBreakpoint(line)
+
+	case "watch", "unwatch":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs a register", cmd)
+		}
+		if cmd == "unwatch" {
+			return d.Unwatch(args[0])
+		}
+		return d.Watch(args[0])
+
+	case "r", "regs":
+		fmt.Fprintf(w, "%+v\n", d.Registers())
+
+	case "l", "list":
+		list(d, w)
+
+	case "h", "help":
+		fmt.Fprint(w, help)
+
+	default:
+		return fmt.Errorf("unknown command %q; try 'help'", cmd)
+	}
+	return nil
+}
+
+// optionalCount parses the optional repeat count for step and back.
+func optionalCount(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
+// show prints the next instruction and the registers.
+func show(d *alu.Debugger, w io.Writer) {
+	line, ok := d.Line()
+	if !ok {
+		fmt.Fprintf(w, "finished after %d steps  %+v\n", d.Steps(), d.Registers())
+		return
+	}
+	src, _ := d.Current()
+	fmt.Fprintf(w, "line %d: %-12s %+v\n", line, src, d.Registers())
+}
+
+// list prints the whole program, with a marker at the next instruction and
+// at each breakpoint.
+func list(d *alu.Debugger, w io.Writer) {
+	next, ok := d.Index()
+	if !ok {
+		next = -1
+	}
+	breaks := make(map[int]bool)
+	for _, line := range d.Breakpoints() {
+		breaks[line] = true
+	}
+
+	// %+v writes one line for each instruction, in order, and then a line
+	// for any label at the end of the program:
+	code := d.Program()
+	text := fmt.Sprintf("%+v", code)
+	for i, src := range strings.SplitAfter(text, "\n") {
+		if src == "" {
+			continue
+		}
+
+		marker := "  "
+		if i < len(code) {
+			if breaks[code.Line(i)] {
+				marker = "* "
+			}
+			if i == next {
+				marker = marker[:1] + ">"
+			}
+		}
+		fmt.Fprintf(w, "%s %s", marker, src)
+	}
+}
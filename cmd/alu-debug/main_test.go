@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nealmcc/aoc2021/pkg/alu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebug(t *testing.T) {
+	code, err := alu.Compile([]byte("inp w\nadd x w\nmul x 2\ninp y\nadd z y\n"))
+	require.NoError(t, err)
+
+	d := alu.NewDebugger(code, alu.Digits("37"))
+	var out strings.Builder
+	debug(d, strings.NewReader(`step 2
+back
+b 4
+watch z
+list
+c
+c
+regs
+bogus
+c
+q
+`), &out)
+
+	want := `line 1: inp w        {W:0 X:0 Y:0 Z:0}
+(alu) line 3: mul x 2      {W:3 X:3 Y:0 Z:0}
+(alu) line 2: add x w      {W:3 X:0 Y:0 Z:0}
+(alu) (alu) (alu)    1  inp w
+ > 2  add x w
+   3  mul x 2
+*  4  inp y
+   5  add z y
+(alu) stopped: breakpoint
+line 4: inp y        {W:3 X:6 Y:0 Z:0}
+(alu) stopped: watchpoint
+finished after 5 steps  {W:3 X:6 Y:7 Z:7}
+(alu) {W:3 X:6 Y:7 Z:7}
+(alu) error: unknown command "bogus"; try 'help'
+(alu) stopped: end
+finished after 5 steps  {W:3 X:6 Y:7 Z:7}
+(alu) `
+	assert.Equal(t, want, out.String())
+}
+
+func TestDebug_listFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.alu": {Data: []byte("inp w\ninclude \"lib.alu\"\njnz w end\nadd z 1\nend:\n")},
+		"lib.alu":  {Data: []byte("add x w\nmul x 2\n")},
+	}
+	code, err := alu.CompileFS(fsys, "main.alu")
+	require.NoError(t, err)
+
+	d := alu.NewDebugger(code, alu.Digits("3"))
+	var out strings.Builder
+	debug(d, strings.NewReader("s\nb 4\nlist\n"), &out)
+
+	want := `line 1: inp w        {W:0 X:0 Y:0 Z:0}
+(alu) line 1: add x w      {W:3 X:0 Y:0 Z:0}
+(alu) (alu)    main.alu:1  inp w
+ >  lib.alu:1  add x w
+    lib.alu:2  mul x 2
+   main.alu:3  jnz w end
+*  main.alu:4  add z 1
+               end:
+(alu) 
+`
+	assert.Equal(t, want, out.String())
+}
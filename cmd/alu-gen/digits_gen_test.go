@@ -0,0 +1,85 @@
+// Code generated by alu.GenerateGo; DO NOT EDIT.
+
+package main
+
+import "errors"
+
+// digits runs an ALU program, reading the values for its inp instructions
+// from input, and returns the final value of each register.
+func digits(input []int) (w, x, y, z int, err error) {
+	next := 0
+	var stack []int
+	var top int
+
+	// line 3: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 3: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 4: inp x
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 4: input requires an input value")
+	}
+	x = input[next]
+	next++
+	// line 5: call digits
+	if len(stack) == 1024 {
+		return w, x, y, z, errors.New("execution failed on line 5: call stack overflow")
+	}
+	stack = append(stack, 3)
+	goto L11
+L3:
+	// line 6: add w x
+	w += x
+	// line 7: call digits
+	if len(stack) == 1024 {
+		return w, x, y, z, errors.New("execution failed on line 7: call stack overflow")
+	}
+	stack = append(stack, 5)
+	goto L11
+L5:
+	// line 8: div z x
+	if x == 0 {
+		return w, x, y, z, errors.New("execution failed on line 8: divide by 0")
+	}
+	z /= x
+	// line 9: mod x 7
+	x %= 7
+	// line 10: jnz x end
+	if x != 0 {
+		goto L18
+	}
+	// line 11: add z 1000
+	z += 1000
+	// line 12: jmp end
+	goto L18
+L11:
+	// line 17: mul y 0
+	y *= 0
+	// line 18: add y w
+	y += w
+	// line 19: mod y 10
+	y %= 10
+	// line 20: add z y
+	z += y
+	// line 21: div w 10
+	w /= 10
+	// line 22: jnz w digits
+	if w != 0 {
+		goto L11
+	}
+	// line 23: ret
+	if len(stack) == 0 {
+		return w, x, y, z, errors.New("execution failed on line 23: return without a call")
+	}
+	top, stack = stack[len(stack)-1], stack[:len(stack)-1]
+	switch top {
+	case 3:
+		goto L3
+	default: // 5
+		goto L5
+	}
+L18:
+	return w, x, y, z, nil
+}
@@ -0,0 +1,59 @@
+// alu-gen compiles an ALU program into a Go function, for use with
+// go generate:
+//
+//	//go:generate go run ../alu-gen -func monad -o monad_gen.go input.txt
+//
+// The package name defaults to $GOPACKAGE, which go generate sets.
+// See alu.GenerateGo for details of the generated function.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nealmcc/aoc2021/pkg/alu"
+)
+
+func main() {
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "the package name for the generated file")
+	name := flag.String("func", "", "the name of the generated function")
+	out := flag.String("o", "", "the output file (default standard output)")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *name == "" || *pkg == "" {
+		fmt.Fprintln(os.Stderr, "usage: alu-gen [-pkg name] -func name [-o file.go] program.txt")
+		os.Exit(2)
+	}
+
+	src, err := generate(flag.Arg(0), *pkg, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*out, src, 0o644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate compiles the program in the named file, and returns the source
+// code of the equivalent Go function.
+func generate(path, pkg, name string) ([]byte, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := alu.Compile(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return alu.GenerateGo(code, pkg, name)
+}
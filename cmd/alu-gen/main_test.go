@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/nealmcc/aoc2021/pkg/alu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:generate go run . -pkg main -func digits -o digits_gen_test.go testdata/digits.alu
+
+// TestGenerate checks that the generated test file is up to date.
+func TestGenerate(t *testing.T) {
+	want, err := os.ReadFile("digits_gen_test.go")
+	require.NoError(t, err)
+
+	got, err := generate("testdata/digits.alu", "main", "digits")
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got), "run go generate")
+}
+
+func TestDigits_vs_ALU(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("testdata/digits.alu")
+	r.NoError(err)
+	code, err := alu.Compile(src)
+	r.NoError(err)
+
+	calc := alu.New(code)
+	rng := rand.New(rand.NewSource(12))
+	for i := 0; i < 1000; i++ {
+		in := []int{rng.Intn(20000) - 10000, rng.Intn(15) - 5}
+		if i%10 == 0 {
+			in = in[:1]
+		}
+
+		wantZ, wantErr := calc.Run(alu.Ints(in...))
+		w, x, y, z, err := digits(in)
+		if wantErr != nil {
+			r.EqualError(err, wantErr.Error(), "input %v", in)
+			continue
+		}
+
+		r.NoError(err, "input %v", in)
+		r.Equal(wantZ, z, "input %v", in)
+		snap := calc.Snapshot()
+		r.Equal(alu.Registers{W: w, X: x, Y: y, Z: z}, snap.Registers, "input %v", in)
+	}
+}
@@ -0,0 +1,235 @@
+// alu is an interactive shell for ALU programs.
+//
+// Usage:
+//
+//	alu [program.txt]
+//
+// Each instruction that is typed into the shell runs straight away, and
+// the registers that it changes are shown. The instructions are also added
+// to the session's program, which can be listed, run again with different
+// input, or saved to a file. Type 'help' for a list of the other commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nealmcc/aoc2021/pkg/alu"
+)
+
+func main() {
+	if len(os.Args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: alu [program.txt]")
+		os.Exit(2)
+	}
+
+	s := new(session)
+	if len(os.Args) == 2 {
+		if err := s.load(os.Args[1]); err != nil {
+			log.Fatal(err)
+		}
+	}
+	repl(s, os.Stdin, os.Stdout)
+}
+
+const help = `Type an instruction, such as 'add z 3', to run it and add it to the program.
+
+commands:
+  input <n>...      queue input values for the inp instructions that you type
+  run [n]...        reset, then run the whole program with the given input
+  reset             set the registers to 0, and discard any queued input
+  clear             reset, and discard the program as well
+  load <file>       replace the program with one read from a file
+  save <file>       write the program to a file
+  r, regs           show the registers
+  l, list           show the program
+  q, quit           exit
+`
+
+// maxSteps limits how many instructions a single typed instruction can
+// run, in case it jumps back into a loop that never ends.
+const maxSteps = 1 << 20
+
+// session is the state of the shell: a program, which grows as each
+// instruction is typed, and the registers left by the last instruction.
+type session struct {
+	src   []byte // src is the program's canonical source code.
+	code  alu.Program
+	regs  alu.Registers
+	input []int // input holds the values queued for inp instructions.
+}
+
+// repl reads commands and instructions from r, and writes the results to
+// w, until the user quits or r is exhausted.
+func repl(s *session, r io.Reader, w io.Writer) {
+	sc := bufio.NewScanner(r)
+	for fmt.Fprint(w, "alu> "); sc.Scan(); fmt.Fprint(w, "alu> ") {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		cmd, args := fields[0], fields[1:]
+
+		if cmd == "q" || cmd == "quit" {
+			return
+		}
+		if err := command(s, w, sc.Text(), cmd, args); err != nil {
+			fmt.Fprintln(w, "error:", err)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// command executes a single command, or else treats the whole line as an
+// instruction.
+func command(s *session, w io.Writer, line, cmd string, args []string) error {
+	switch cmd {
+	case "input":
+		values, err := parseInts(args)
+		if err != nil {
+			return err
+		}
+		s.input = append(s.input, values...)
+
+	case "run":
+		values, err := parseInts(args)
+		if err != nil {
+			return err
+		}
+		return s.run(w, values)
+
+	case "reset":
+		s.reset()
+
+	case "clear":
+		*s = session{}
+
+	case "load", "save":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs a file name", cmd)
+		}
+		if cmd == "save" {
+			return os.WriteFile(args[0], s.src, 0o644)
+		}
+		if err := s.load(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "loaded %d instructions\n", len(s.code))
+
+	case "r", "regs":
+		fmt.Fprintf(w, "%+v\n", s.regs)
+
+	case "l", "list":
+		fmt.Fprintf(w, "%+v", s.code)
+
+	case "h", "help":
+		fmt.Fprint(w, help)
+
+	default:
+		return s.exec(w, line)
+	}
+	return nil
+}
+
+// parseInts parses each argument as an integer.
+func parseInts(args []string) ([]int, error) {
+	values := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input value %q", arg)
+		}
+		values[i] = n
+	}
+	return values, nil
+}
+
+// reset sets the registers to 0, and discards any queued input.
+func (s *session) reset() {
+	s.regs, s.input = alu.Registers{}, nil
+}
+
+// load replaces the program with the named file, which may include other
+// files from the same directory, and resets the registers.
+func (s *session) load(name string) error {
+	code, err := alu.CompileFS(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	src, err := code.MarshalText()
+	if err != nil {
+		return err
+	}
+	s.src, s.code = src, code
+	s.reset()
+	return nil
+}
+
+// exec adds a line of source code to the program, and runs the
+// instructions that it adds, starting from the current registers and
+// reading any queued input. If the line does not compile, or fails when it
+// runs, the program and registers are left as they were.
+func (s *session) exec(w io.Writer, line string) error {
+	src := append(append([]byte(nil), s.src...), line+"\n"...)
+	code, err := alu.Compile(src)
+	if err != nil {
+		return err
+	}
+
+	calc := alu.New(code)
+	calc.SetBudget(maxSteps)
+	if err := calc.Restore(alu.Snapshot{Registers: s.regs, PC: len(s.code)}); err != nil {
+		return err
+	}
+	if _, err := calc.Resume(context.Background(), alu.Ints(s.input...)); err != nil {
+		return err
+	}
+
+	after := calc.Snapshot()
+	showChanges(w, s.regs, after.Registers)
+	s.src, s.code, s.regs = src, code, after.Registers
+	s.input = s.input[len(after.Consumed):]
+	return nil
+}
+
+// run resets the registers, and runs the whole program with the given
+// input.
+func (s *session) run(w io.Writer, input []int) error {
+	s.reset()
+	calc := alu.New(s.code)
+	z, err := calc.Run(alu.Ints(input...))
+	s.regs = calc.Snapshot().Registers
+	if err != nil {
+		fmt.Fprintf(w, "%+v\n", s.regs)
+		return err
+	}
+	fmt.Fprintf(w, "z = %d  %+v\n", z, s.regs)
+	return nil
+}
+
+// showChanges prints each register that differs between before and after.
+func showChanges(w io.Writer, before, after alu.Registers) {
+	var changes []string
+	add := func(name string, was, is int) {
+		if was != is {
+			changes = append(changes, fmt.Sprintf("%s: %d -> %d", name, was, is))
+		}
+	}
+	add("w", before.W, after.W)
+	add("x", before.X, after.X)
+	add("y", before.Y, after.Y)
+	add("z", before.Z, after.Z)
+
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no change")
+		return
+	}
+	fmt.Fprintln(w, strings.Join(changes, "  "))
+}
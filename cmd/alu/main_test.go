@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepl(t *testing.T) {
+	dir := t.TempDir()
+	saved := filepath.Join(dir, "saved.txt")
+
+	s := new(session)
+	var out strings.Builder
+	repl(s, strings.NewReader(`input 7
+inp w
+add z w
+mul z 2
+eql x 0
+add x y
+inp y
+div z y
+regs
+list
+save `+saved+`
+run 3
+run
+reset
+bogus
+jmp a extra
+clear
+list
+load `+saved+`
+run 5
+q
+`), &out)
+
+	want := `alu> alu> w: 0 -> 7
+alu> z: 0 -> 7
+alu> z: 7 -> 14
+alu> x: 0 -> 1
+alu> no change
+alu> error: execution failed on line 6: input requires an input value
+alu> error: execution failed on line 6: divide by 0
+alu> {W:7 X:1 Y:0 Z:14}
+alu> 1  inp w
+2  add z w
+3  mul z 2
+4  eql x 0
+5  add x y
+alu> alu> z = 6  {W:3 X:1 Y:0 Z:6}
+alu> {W:0 X:0 Y:0 Z:0}
+error: execution failed on line 1: input requires an input value
+alu> alu> error: line 6, col 1: unrecognised opcode "bogus"
+alu> error: line 6, col 7: unexpected identifier "extra" after jmp instruction
+alu> alu> alu> loaded 5 instructions
+alu> z = 10  {W:5 X:1 Y:0 Z:10}
+alu> `
+	assert.Equal(t, want, out.String())
+
+	src, err := os.ReadFile(saved)
+	require.NoError(t, err)
+	assert.Equal(t, "inp w\nadd z w\nmul z 2\neql x 0\nadd x y\n", string(src))
+}
@@ -77,7 +77,10 @@ var (
 	magic2 = []int{15, 12, 15, 12, 15, 2, 11, 15, 10, 2, 0, 0, 15, 15}
 )
 
+//go:generate go run ../alu-gen -func monadGen -o monad_gen.go input.txt
+
 // monad is the equivalent of the input program, but written more concisely.
+// monadGen, in monad_gen.go, is a direct translation of the same program.
 // It's not actually part of the solution for day24, but is useful to ensure
 // the 'backward' function is correct.
 func monad(input []byte) int {
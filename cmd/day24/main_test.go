@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"math/rand"
 	"os"
 	"testing"
 
@@ -89,9 +89,14 @@ func TestMonad_vs_ALU(t *testing.T) {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			r := require.New(t)
-			// calc.EnableTrace(zaptest.NewLogger(t).Sugar())
+			// calc.SetTracer(alu.NewJSONTracer(os.Stderr))
 
-			aluResult, err := calc.Run(bytes.NewReader(tc.in))
+			digits := make([]int, len(tc.in))
+			for i, b := range tc.in {
+				digits[i] = int(b)
+			}
+
+			aluResult, err := calc.Run(alu.Ints(digits...))
 			if tc.wantErr {
 				r.Error(err)
 				return
@@ -106,6 +111,63 @@ func TestMonad_vs_ALU(t *testing.T) {
 	}
 }
 
+func TestMonad_equivalent(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("input.txt")
+	r.NoError(err)
+
+	code, err := alu.Compile(src)
+	r.NoError(err)
+
+	reference := func(in []int) int {
+		digits := make([]byte, len(in))
+		for i, n := range in {
+			digits[i] = byte(n)
+		}
+		return monad(digits)
+	}
+
+	got, err := alu.CheckEquivalent(code, reference, alu.EquivalenceOptions{
+		Length:   14,
+		Alphabet: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		Samples:  5000,
+		Seed:     24,
+	})
+	r.NoError(err)
+	r.Nil(got.Counterexample, "%v", got.Counterexample)
+	r.Equal(5000, got.Checked)
+}
+
+func TestMonadGen_vs_ALU(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("input.txt")
+	r.NoError(err)
+
+	code, err := alu.Compile(src)
+	r.NoError(err)
+
+	calc := alu.New(code)
+	rng := rand.New(rand.NewSource(24))
+	digits := make([]int, 14)
+	for i := 0; i < 1000; i++ {
+		for j := range digits {
+			digits[j] = 1 + rng.Intn(9)
+		}
+
+		want, err := calc.Run(alu.Ints(digits...))
+		r.NoError(err)
+
+		_, _, _, got, err := monadGen(digits)
+		r.NoError(err)
+		r.Equal(want, got, "input %v", digits)
+	}
+
+	_, _, _, _, err = monadGen(digits[:13])
+	r.EqualError(err, "execution failed on line 235: input requires an input value")
+}
+
 func TestBackward(t *testing.T) {
 	for i := 0; i < 14; i++ {
 		for digit := 1; digit <= 9; digit++ {
@@ -121,3 +183,33 @@ func TestBackward(t *testing.T) {
 		}
 	}
 }
+
+func TestSolve_vs_ALUSearch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping ALU search in short mode")
+	}
+	r := require.New(t)
+
+	src, err := os.ReadFile("input.txt")
+	r.NoError(err)
+
+	code, err := alu.Compile(src)
+	r.NoError(err)
+
+	digits := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	toInt := func(ds []int) int {
+		n := 0
+		for _, d := range ds {
+			n = 10*n + d
+		}
+		return n
+	}
+
+	largest, err := alu.FindLargest(code, digits, 14, alu.ZeroZ)
+	r.NoError(err)
+	assert.Equal(t, solve(true), toInt(largest))
+
+	smallest, err := alu.FindSmallest(code, digits, 14, alu.ZeroZ)
+	r.NoError(err)
+	assert.Equal(t, solve(false), toInt(smallest))
+}
@@ -0,0 +1,685 @@
+// Code generated by alu.GenerateGo; DO NOT EDIT.
+
+package main
+
+import "errors"
+
+// monadGen runs an ALU program, reading the values for its inp instructions
+// from input, and returns the final value of each register.
+func monadGen(input []int) (w, x, y, z int, err error) {
+	next := 0
+
+	// line 1: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 1: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 2: mul x 0
+	x *= 0
+	// line 3: add x z
+	x += z
+	// line 4: mod x 26
+	x %= 26
+	// line 5: div z 1
+	z /= 1
+	// line 6: add x 12
+	x += 12
+	// line 7: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 8: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 9: mul y 0
+	y *= 0
+	// line 10: add y 25
+	y += 25
+	// line 11: mul y x
+	y *= x
+	// line 12: add y 1
+	y += 1
+	// line 13: mul z y
+	z *= y
+	// line 14: mul y 0
+	y *= 0
+	// line 15: add y w
+	y += w
+	// line 16: add y 15
+	y += 15
+	// line 17: mul y x
+	y *= x
+	// line 18: add z y
+	z += y
+	// line 19: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 19: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 20: mul x 0
+	x *= 0
+	// line 21: add x z
+	x += z
+	// line 22: mod x 26
+	x %= 26
+	// line 23: div z 1
+	z /= 1
+	// line 24: add x 14
+	x += 14
+	// line 25: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 26: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 27: mul y 0
+	y *= 0
+	// line 28: add y 25
+	y += 25
+	// line 29: mul y x
+	y *= x
+	// line 30: add y 1
+	y += 1
+	// line 31: mul z y
+	z *= y
+	// line 32: mul y 0
+	y *= 0
+	// line 33: add y w
+	y += w
+	// line 34: add y 12
+	y += 12
+	// line 35: mul y x
+	y *= x
+	// line 36: add z y
+	z += y
+	// line 37: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 37: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 38: mul x 0
+	x *= 0
+	// line 39: add x z
+	x += z
+	// line 40: mod x 26
+	x %= 26
+	// line 41: div z 1
+	z /= 1
+	// line 42: add x 11
+	x += 11
+	// line 43: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 44: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 45: mul y 0
+	y *= 0
+	// line 46: add y 25
+	y += 25
+	// line 47: mul y x
+	y *= x
+	// line 48: add y 1
+	y += 1
+	// line 49: mul z y
+	z *= y
+	// line 50: mul y 0
+	y *= 0
+	// line 51: add y w
+	y += w
+	// line 52: add y 15
+	y += 15
+	// line 53: mul y x
+	y *= x
+	// line 54: add z y
+	z += y
+	// line 55: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 55: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 56: mul x 0
+	x *= 0
+	// line 57: add x z
+	x += z
+	// line 58: mod x 26
+	x %= 26
+	// line 59: div z 26
+	z /= 26
+	// line 60: add x -9
+	x += -9
+	// line 61: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 62: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 63: mul y 0
+	y *= 0
+	// line 64: add y 25
+	y += 25
+	// line 65: mul y x
+	y *= x
+	// line 66: add y 1
+	y += 1
+	// line 67: mul z y
+	z *= y
+	// line 68: mul y 0
+	y *= 0
+	// line 69: add y w
+	y += w
+	// line 70: add y 12
+	y += 12
+	// line 71: mul y x
+	y *= x
+	// line 72: add z y
+	z += y
+	// line 73: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 73: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 74: mul x 0
+	x *= 0
+	// line 75: add x z
+	x += z
+	// line 76: mod x 26
+	x %= 26
+	// line 77: div z 26
+	z /= 26
+	// line 78: add x -7
+	x += -7
+	// line 79: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 80: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 81: mul y 0
+	y *= 0
+	// line 82: add y 25
+	y += 25
+	// line 83: mul y x
+	y *= x
+	// line 84: add y 1
+	y += 1
+	// line 85: mul z y
+	z *= y
+	// line 86: mul y 0
+	y *= 0
+	// line 87: add y w
+	y += w
+	// line 88: add y 15
+	y += 15
+	// line 89: mul y x
+	y *= x
+	// line 90: add z y
+	z += y
+	// line 91: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 91: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 92: mul x 0
+	x *= 0
+	// line 93: add x z
+	x += z
+	// line 94: mod x 26
+	x %= 26
+	// line 95: div z 1
+	z /= 1
+	// line 96: add x 11
+	x += 11
+	// line 97: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 98: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 99: mul y 0
+	y *= 0
+	// line 100: add y 25
+	y += 25
+	// line 101: mul y x
+	y *= x
+	// line 102: add y 1
+	y += 1
+	// line 103: mul z y
+	z *= y
+	// line 104: mul y 0
+	y *= 0
+	// line 105: add y w
+	y += w
+	// line 106: add y 2
+	y += 2
+	// line 107: mul y x
+	y *= x
+	// line 108: add z y
+	z += y
+	// line 109: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 109: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 110: mul x 0
+	x *= 0
+	// line 111: add x z
+	x += z
+	// line 112: mod x 26
+	x %= 26
+	// line 113: div z 26
+	z /= 26
+	// line 114: add x -1
+	x += -1
+	// line 115: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 116: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 117: mul y 0
+	y *= 0
+	// line 118: add y 25
+	y += 25
+	// line 119: mul y x
+	y *= x
+	// line 120: add y 1
+	y += 1
+	// line 121: mul z y
+	z *= y
+	// line 122: mul y 0
+	y *= 0
+	// line 123: add y w
+	y += w
+	// line 124: add y 11
+	y += 11
+	// line 125: mul y x
+	y *= x
+	// line 126: add z y
+	z += y
+	// line 127: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 127: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 128: mul x 0
+	x *= 0
+	// line 129: add x z
+	x += z
+	// line 130: mod x 26
+	x %= 26
+	// line 131: div z 26
+	z /= 26
+	// line 132: add x -16
+	x += -16
+	// line 133: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 134: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 135: mul y 0
+	y *= 0
+	// line 136: add y 25
+	y += 25
+	// line 137: mul y x
+	y *= x
+	// line 138: add y 1
+	y += 1
+	// line 139: mul z y
+	z *= y
+	// line 140: mul y 0
+	y *= 0
+	// line 141: add y w
+	y += w
+	// line 142: add y 15
+	y += 15
+	// line 143: mul y x
+	y *= x
+	// line 144: add z y
+	z += y
+	// line 145: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 145: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 146: mul x 0
+	x *= 0
+	// line 147: add x z
+	x += z
+	// line 148: mod x 26
+	x %= 26
+	// line 149: div z 1
+	z /= 1
+	// line 150: add x 11
+	x += 11
+	// line 151: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 152: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 153: mul y 0
+	y *= 0
+	// line 154: add y 25
+	y += 25
+	// line 155: mul y x
+	y *= x
+	// line 156: add y 1
+	y += 1
+	// line 157: mul z y
+	z *= y
+	// line 158: mul y 0
+	y *= 0
+	// line 159: add y w
+	y += w
+	// line 160: add y 10
+	y += 10
+	// line 161: mul y x
+	y *= x
+	// line 162: add z y
+	z += y
+	// line 163: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 163: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 164: mul x 0
+	x *= 0
+	// line 165: add x z
+	x += z
+	// line 166: mod x 26
+	x %= 26
+	// line 167: div z 26
+	z /= 26
+	// line 168: add x -15
+	x += -15
+	// line 169: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 170: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 171: mul y 0
+	y *= 0
+	// line 172: add y 25
+	y += 25
+	// line 173: mul y x
+	y *= x
+	// line 174: add y 1
+	y += 1
+	// line 175: mul z y
+	z *= y
+	// line 176: mul y 0
+	y *= 0
+	// line 177: add y w
+	y += w
+	// line 178: add y 2
+	y += 2
+	// line 179: mul y x
+	y *= x
+	// line 180: add z y
+	z += y
+	// line 181: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 181: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 182: mul x 0
+	x *= 0
+	// line 183: add x z
+	x += z
+	// line 184: mod x 26
+	x %= 26
+	// line 185: div z 1
+	z /= 1
+	// line 186: add x 10
+	x += 10
+	// line 187: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 188: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 189: mul y 0
+	y *= 0
+	// line 190: add y 25
+	y += 25
+	// line 191: mul y x
+	y *= x
+	// line 192: add y 1
+	y += 1
+	// line 193: mul z y
+	z *= y
+	// line 194: mul y 0
+	y *= 0
+	// line 195: add y w
+	y += w
+	// line 196: add y 0
+	y += 0
+	// line 197: mul y x
+	y *= x
+	// line 198: add z y
+	z += y
+	// line 199: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 199: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 200: mul x 0
+	x *= 0
+	// line 201: add x z
+	x += z
+	// line 202: mod x 26
+	x %= 26
+	// line 203: div z 1
+	z /= 1
+	// line 204: add x 12
+	x += 12
+	// line 205: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 206: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 207: mul y 0
+	y *= 0
+	// line 208: add y 25
+	y += 25
+	// line 209: mul y x
+	y *= x
+	// line 210: add y 1
+	y += 1
+	// line 211: mul z y
+	z *= y
+	// line 212: mul y 0
+	y *= 0
+	// line 213: add y w
+	y += w
+	// line 214: add y 0
+	y += 0
+	// line 215: mul y x
+	y *= x
+	// line 216: add z y
+	z += y
+	// line 217: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 217: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 218: mul x 0
+	x *= 0
+	// line 219: add x z
+	x += z
+	// line 220: mod x 26
+	x %= 26
+	// line 221: div z 26
+	z /= 26
+	// line 222: add x -4
+	x += -4
+	// line 223: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 224: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 225: mul y 0
+	y *= 0
+	// line 226: add y 25
+	y += 25
+	// line 227: mul y x
+	y *= x
+	// line 228: add y 1
+	y += 1
+	// line 229: mul z y
+	z *= y
+	// line 230: mul y 0
+	y *= 0
+	// line 231: add y w
+	y += w
+	// line 232: add y 15
+	y += 15
+	// line 233: mul y x
+	y *= x
+	// line 234: add z y
+	z += y
+	// line 235: inp w
+	if next == len(input) {
+		return w, x, y, z, errors.New("execution failed on line 235: input requires an input value")
+	}
+	w = input[next]
+	next++
+	// line 236: mul x 0
+	x *= 0
+	// line 237: add x z
+	x += z
+	// line 238: mod x 26
+	x %= 26
+	// line 239: div z 26
+	z /= 26
+	// line 240: add x 0
+	x += 0
+	// line 241: eql x w
+	if x == w {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 242: eql x 0
+	if x == 0 {
+		x = 1
+	} else {
+		x = 0
+	}
+	// line 243: mul y 0
+	y *= 0
+	// line 244: add y 25
+	y += 25
+	// line 245: mul y x
+	y *= x
+	// line 246: add y 1
+	y += 1
+	// line 247: mul z y
+	z *= y
+	// line 248: mul y 0
+	y *= 0
+	// line 249: add y w
+	y += w
+	// line 250: add y 15
+	y += 15
+	// line 251: mul y x
+	y *= x
+	// line 252: add z y
+	z += y
+	return w, x, y, z, nil
+}
@@ -2,235 +2,545 @@
 package alu
 
 import (
-	"bufio"
+	"context"
 	"io"
-	"reflect"
-	"runtime"
-	"strings"
+	"math/big"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
-	"go.uber.org/zap"
 )
 
+//go:generate go run gen_exec.go
+
 // ALU is an Arithmetic Logic Unit
 type ALU struct {
-	mu   sync.Mutex
-	in   *bufio.Scanner
-	reg  [4]int
-	code Program
-	log  *zap.SugaredLogger
+	mu       sync.Mutex
+	in       Input
+	reg      [4]int
+	pc       int   // pc is the index of the next instruction to execute.
+	stack    []int // stack holds the return address of each call in progress.
+	consumed []int // consumed holds the input values read so far.
+	budget   int   // budget is the most instructions to execute per run.
+	code     Program
+	tracer   Tracer
+
+	opts   Options
+	custom bool        // custom is true if opts are not the defaults.
+	big    *[4]big.Int // big holds the registers with WidthBig.
 }
 
 // Program is the sequence of instructions that the ALU will execute.
 type Program []instruction
 
+// Line returns the source line of the instruction at index i.
+func (p Program) Line(i int) int {
+	return p[i].line
+}
+
 // instruction is a command for the ALU to perform.
+// Instructions are plain values, so that a Program is a compact array which
+// the ALU can execute without any indirect calls or type assertions.
 type instruction struct {
-	fn   operation
+	op   opcode
 	r1   registerID
-	p2   interface{}
+	p2   operand
 	line int
+	exec uint8    // exec is the dispatch code for op, r1 and p2; see dispatchCode.
+	src  *srcInfo // src is set for code from a file or a macro; see CompileFS.
+}
+
+// dispatchCode combines an instruction's opcode, first register and operand
+// into a single number, so that the ALU can choose what to execute with
+// just one switch. Codes are dense, starting from 0. Control flow
+// instructions all share one code, since they are executed by step.
+func dispatchCode(op opcode, r1 registerID, p2 operand) uint8 {
+	if op.isControl() {
+		return execControl
+	}
+	src := uint8(4) // an immediate operand, or none
+	if p2.kind == registerOperand {
+		src = uint8(p2.reg)
+	}
+	return uint8(op)*20 + uint8(r1)*5 + src
+}
+
+// Dispatch codes for fused instructions start after the codes for single
+// instructions. Each range has room for every r1 and operand.
+const (
+	execSet    = 120 // 'mul r 0 ; add r p2' sets r to p2
+	execNeq    = 140 // 'eql r p2 ; eql r 0' compares r != p2
+	execMulAdd = 160 // 'mul r p2 ; add r n' sets r to r * p2 + n
+	execSetAdd = 180 // 'mul r 0 ; add r p2 ; add r n' sets r to p2 + n
+
+	// execControl is the code for every jmp, jnz, call and ret instruction
+	execControl = 200
+)
+
+// execLen returns the number of instructions executed by the given dispatch
+// code: more than 1 for a fused instruction.
+func execLen(exec uint8) int {
+	switch {
+	case exec >= execControl:
+		return 1
+	case exec >= execSetAdd:
+		return 3
+	case exec >= execSet:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// fuse returns a copy of the program where each run of instructions that can
+// be executed as one has a fused dispatch code on its first instruction.
+// The other instructions are left in place, and are skipped by executeFast.
+// Fused instructions only look forwards, so execution can still start at
+// any instruction.
+//
+// No fused instruction includes an inp, so the result can safely be split
+// into segments just before any inp instruction.
+func fuse(code Program) Program {
+	out := append(Program(nil), code...)
+
+	// matches checks if the instruction at index i exists, acts on register
+	// r, and has the given opcode. It also checks the instruction does not
+	// read r, since fused instructions always read their operand before r
+	// is updated.
+	matches := func(i int, r registerID, op opcode) bool {
+		if i >= len(out) || out[i].r1 != r || out[i].op != op {
+			return false
+		}
+		r2, ok := out[i].p2.isRegister()
+		return !ok || r2 != r
+	}
+
+	// isConst checks if the instruction at index i has the immediate operand n.
+	isConst := func(i, n int) bool {
+		m, ok := out[i].p2.isImmediate()
+		return ok && m == n
+	}
+
+	// isImm checks if the instruction at index i has an immediate operand.
+	isImm := func(i int) bool {
+		_, ok := out[i].p2.isImmediate()
+		return ok
+	}
+
+	for i := range out {
+		r := out[i].r1
+		if !matches(i, r, out[i].op) {
+			continue
+		}
+
+		switch {
+		case out[i].op == opMultiply && isConst(i, 0) && matches(i+1, r, opAdd):
+			if matches(i+2, r, opAdd) && isImm(i+2) {
+				out[i].exec = execSetAdd + dispatchCode(0, r, out[i+1].p2)
+			} else {
+				out[i].exec = execSet + dispatchCode(0, r, out[i+1].p2)
+			}
+
+		case out[i].op == opEquals && matches(i+1, r, opEquals) && isConst(i+1, 0):
+			out[i].exec = execNeq + dispatchCode(0, r, out[i].p2)
+
+		case out[i].op == opMultiply && matches(i+1, r, opAdd) && isImm(i+1):
+			out[i].exec = execMulAdd + dispatchCode(0, r, out[i].p2)
+		}
+	}
+	return out
+}
+
+// operandKind tags the type of value held by an operand.
+type operandKind byte
+
+const (
+	noOperand        operandKind = iota // the instruction takes one operand
+	registerOperand                     // the operand is a register
+	immediateOperand                    // the operand is an integer literal
+	labelOperand                        // the operand is a jump target
+)
+
+// operand is the second parameter to an instruction.
+type operand struct {
+	kind  operandKind
+	reg   registerID // reg is the register to read, for a register operand.
+	n     int        // n is the value of an immediate, or a label's index.
+	label string     // label is the name of a label operand.
+}
+
+// regOperand makes an operand that reads the given register.
+func regOperand(r registerID) operand {
+	return operand{kind: registerOperand, reg: r}
+}
+
+// immOperand makes an operand with the given immediate value.
+func immOperand(n int) operand {
+	return operand{kind: immediateOperand, n: n}
+}
+
+// targetOperand makes an operand for the label with the given name, which
+// names the instruction at the given index.
+func targetOperand(name string, index int) operand {
+	return operand{kind: labelOperand, n: index, label: name}
+}
+
+// isImmediate returns the operand's value, and true if it is an immediate.
+func (o operand) isImmediate() (int, bool) {
+	return o.n, o.kind == immediateOperand
+}
+
+// isRegister returns the operand's register, and true if it is a register.
+func (o operand) isRegister() (registerID, bool) {
+	return o.reg, o.kind == registerOperand
 }
 
-type operation func(*ALU, registerID, interface{}) error
+// String implements fmt.Stringer.
+func (o operand) String() string {
+	switch o.kind {
+	case registerOperand:
+		return o.reg.String()
+	case immediateOperand:
+		return strconv.Itoa(o.n)
+	case labelOperand:
+		return o.label
+	default:
+		return ""
+	}
+}
 
-// registerID is the identifier for each of the ALU's registers
+// registerID is the identifier for each of the ALU's registers. It is also
+// the register's index in the ALU's array of registers.
 type registerID byte
 
 const (
-	regW registerID = 'w'
-	regX registerID = 'x'
-	regY registerID = 'y'
-	regZ registerID = 'z'
+	regW registerID = iota
+	regX
+	regY
+	regZ
 )
 
+// registerNames holds the name used in source code for each register.
+var registerNames = [...]byte{regW: 'w', regX: 'x', regY: 'y', regZ: 'z'}
+
+// String implements fmt.Stringer, returning the register's name.
+func (reg registerID) String() string {
+	return string(registerNames[reg&3])
+}
+
 // MarshalJSON implements json.Marshaller, so that register IDs will print
 // nicely in traces.
 func (reg registerID) MarshalJSON() ([]byte, error) {
-	return []byte{'"', byte(reg), '"'}, nil
+	return []byte{'"', registerNames[reg&3], '"'}, nil
 }
 
 // New initializes a new ALU with the given pre-compiled program.
 func New(code Program) *ALU {
-	return &ALU{code: code}
+	return &ALU{code: fuse(code)}
 }
 
-// EnableTrace makes this ALU write trace output to the given logger.
-func (a *ALU) EnableTrace(log *zap.SugaredLogger) {
-	a.log = log
+// SetBudget limits each run to executing at most n instructions.
+// A budget of 0 (the default) means there is no limit.
+func (a *ALU) SetBudget(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.budget = n
 }
 
-// Reset this ALU's registers to 0.
+// MaxCallDepth is the most calls that can be in progress at once. A call
+// instruction fails if it would go deeper.
+const MaxCallDepth = 1024
+
+// ErrBudgetExceeded is returned when a run uses up its instruction budget
+// before the end of the program. See SetBudget.
+var ErrBudgetExceeded = errors.New("the instruction budget was exceeded")
+
+// Reset this ALU's registers to 0, and move back to the start of the program.
 func (a *ALU) Reset() {
 	for i := range a.reg {
 		a.reg[i] = 0
 	}
+	if a.big != nil {
+		for i := range a.big {
+			a.big[i].SetInt64(0)
+		}
+	}
+	a.pc = 0
+	a.stack = a.stack[:0]
+	a.consumed = a.consumed[:0]
 }
 
-// Run executes this ALU's program, reading its input from r.
+// Run executes this ALU's program, reading its input from in.
+// If the program reads more values than in can supply, Run returns an
+// *EndOfInputError.
 // An ALU will only execute one Run() command at a time.
-func (a *ALU) Run(r io.Reader) (int, error) {
+func (a *ALU) Run(in Input) (int, error) {
+	return a.RunContext(context.Background(), in)
+}
+
+// RunContext is like Run, but stops early with the context's error if the
+// context is cancelled, or with ErrBudgetExceeded if the program runs for
+// longer than the ALU's budget.
+//
+// When a run stops early, the ALU keeps its state, so that it can be saved
+// with Snapshot or continued with Resume.
+func (a *ALU) RunContext(ctx context.Context, in Input) (int, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	a.Reset()
+	return a.resume(ctx, in)
+}
+
+// Resume continues running the program from wherever the previous run
+// stopped, or from a state loaded with Restore, reading further input
+// from in. It stops early in the same way as RunContext.
+func (a *ALU) Resume(ctx context.Context, in Input) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	a.in = bufio.NewScanner(r)
-	a.in.Split(bufio.ScanBytes)
+	return a.resume(ctx, in)
+}
 
-	for i, inst := range a.code {
-		if a.log != nil {
-			a.log.Debugw("begin instruction",
-				"line", inst.line,
-				"seq", i+1,
-				"fn", getFunctionName(inst.fn),
-				"r1", inst.r1,
-				"p2", inst.p2)
-		}
-		err := inst.fn(a, inst.r1, inst.p2)
-		if err != nil {
-			return 1, errors.Wrapf(err, "execution failed on line %d", inst.line)
-		}
-		if a.log != nil {
-			a.log.Debugw("instruction complete", "line", inst.line, "registers", a.reg)
-		}
+func (a *ALU) resume(ctx context.Context, in Input) (int, error) {
+	a.in = in
+	defer func() { a.in = nil }()
+
+	if err := a.executeFrom(ctx); err != nil {
+		return 1, err
 	}
 
+	if a.big != nil && !fitsInt(&a.big[regZ]) {
+		return 1, errors.New("the result is too large for an int; see BigRegisters")
+	}
 	return a.get(regZ), nil
 }
 
-// input reads a value from the ALU's input and saves it in the given register.
-func (a *ALU) input(r1 registerID, _ interface{}) error {
-	if ok := a.in.Scan(); !ok {
-		return errors.New("input requires an input value")
+// chunkSize is the number of instructions that executeFrom runs between
+// checks of the context.
+const chunkSize = 1 << 12
+
+// executeFrom runs the program from the program counter to the end.
+func (a *ALU) executeFrom(ctx context.Context) error {
+	var (
+		code      = a.code
+		check     = ctx.Done() != nil || a.budget != 0
+		remaining = a.budget
+	)
+
+	for a.pc < len(code) {
+		end := len(code)
+		if check {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if end-a.pc > chunkSize {
+				end = a.pc + chunkSize
+			}
+			if a.budget != 0 {
+				if remaining == 0 {
+					return ErrBudgetExceeded
+				}
+				if end-a.pc > remaining {
+					end = a.pc + remaining
+				}
+			}
+			end = splitPoint(code, a.pc, end)
+		}
+
+		var (
+			start = a.pc
+			err   error
+		)
+		if end == start || code[start].op.isControl() {
+			// either a control flow instruction, or the next fused
+			// instruction doesn't fit in the budget, so take one step:
+			err = a.stepTrace()
+			remaining--
+		} else {
+			a.pc, err = a.execute(start, end)
+			remaining -= a.pc - start
+		}
+		if err != nil {
+			return err
+		}
 	}
-	n := a.in.Bytes()[0]
-	a.set(r1, int(n))
 	return nil
 }
 
-// addRegister adds the value stored in r2 to r1. Always returns a nil error.
-func (a *ALU) addRegister(r1 registerID, p2 interface{}) error {
-	r2 := p2.(registerID)
-
-	sum := a.get(r1) + a.get(r2)
-	a.set(r1, sum)
-	return nil
+// splitPoint returns the largest index, between start and end, where the
+// code can be split without splitting a fused instruction apart.
+func splitPoint(code Program, start, end int) int {
+	i := start
+	for {
+		next := i + execLen(code[i].exec)
+		if next > end {
+			return i
+		}
+		if next == end {
+			return end
+		}
+		i = next
+	}
 }
 
-// addImmediate adds n to r1. Always returns a nil error.
-func (a *ALU) addImmediate(r1 registerID, p2 interface{}) error {
-	n := p2.(int)
-
-	sum := a.get(r1) + n
-	a.set(r1, sum)
-	return nil
+// execute runs the program's instructions from index start, and stops at
+// index end, at the first control flow instruction, or at an error. It
+// returns the index where it stopped, which is the index of the failed
+// instruction if there is an error.
+func (a *ALU) execute(start, end int) (int, error) {
+	if a.tracer != nil || a.custom {
+		return a.executeSteps(start, end)
+	}
+	return a.executeFast(a.code, start, end)
 }
 
-// mulRegister multiples r1 by the value stored in r2. Always returns a nil error.
-func (a *ALU) mulRegister(r1 registerID, p2 interface{}) error {
-	r2 := p2.(registerID)
-
-	prod := a.get(r1) * a.get(r2)
-	a.set(r1, prod)
-	return nil
+// executeSteps is the same as execute, but takes one step at a time, so
+// that each instruction can be traced, or use the ALU's options.
+func (a *ALU) executeSteps(start, end int) (int, error) {
+	a.pc = start
+	for a.pc < end && !a.code[a.pc].op.isControl() {
+		if err := a.stepTrace(); err != nil {
+			return a.pc, err
+		}
+	}
+	return a.pc, nil
 }
 
-// mulImmediate multiplies r1 by n. Always returns a nil error.
-func (a *ALU) mulImmediate(r1 registerID, p2 interface{}) error {
-	n := p2.(int)
+// stepTrace is the same as step, but sends an event to the tracer if
+// there is one.
+func (a *ALU) stepTrace() error {
+	if a.tracer == nil {
+		return a.step()
+	}
 
-	prod := a.get(r1) * n
-	a.set(r1, prod)
-	return nil
+	inst := a.code[a.pc]
+	ev := TraceEvent{
+		PC:     a.pc,
+		Line:   inst.line,
+		Before: registers(a.reg),
+		Start:  time.Now(),
+		inst:   inst,
+	}
+	ev.Err = a.step()
+	ev.Duration = time.Since(ev.Start)
+	ev.After = registers(a.reg)
+
+	a.tracer.Trace(ev)
+	return ev.Err
 }
 
-// divRegister divides r1 by the value stored in r2.
-func (a *ALU) divRegister(r1 registerID, p2 interface{}) error {
-	r2 := p2.(registerID)
-	n := a.get(r2)
-	if n == 0 {
-		return errors.New("divide by 0")
+// step executes the instruction at the program counter, and then moves the
+// program counter on to the next instruction. If the instruction fails, the
+// program counter and registers are unchanged. step is the reference
+// implementation of each operation; executeFast must behave in exactly the
+// same way.
+func (a *ALU) step() error {
+	inst := &a.code[a.pc]
+	if a.custom && (!inst.op.isControl() || inst.op == opJumpNotZero) {
+		return a.stepOptions(inst)
 	}
+	r := &a.reg[inst.r1&3]
 
-	quo := a.get(r1) / n
-	a.set(r1, quo)
-	return nil
-}
+	n := inst.p2.n
+	if inst.p2.kind == registerOperand {
+		n = a.reg[inst.p2.reg&3]
+	}
 
-// divImmediate divides r1 by n.
-func (a *ALU) divImmediate(r1 registerID, p2 interface{}) error {
-	// the compiler will prevent n == 0
-	n := p2.(int)
+	switch inst.op {
+	case opInput:
+		n, err := a.read(inst)
+		if err != nil {
+			return err
+		}
+		*r = n
 
-	quo := a.get(r1) / n
-	a.set(r1, quo)
-	return nil
-}
+	case opAdd:
+		*r += n
 
-// modRegister stores r1 % r2 in r1.
-func (a *ALU) modRegister(r1 registerID, p2 interface{}) error {
-	r2 := p2.(registerID)
-	n := a.get(r2)
-	if n == 0 {
-		return errors.New("modulo of 0 is undefined")
-	}
+	case opMultiply:
+		*r *= n
 
-	mod := a.get(r1) % n
-	a.set(r1, mod)
-	return nil
-}
+	case opDivide:
+		if n == 0 {
+			return errDivide(inst)
+		}
+		*r /= n
 
-// modImmediate stores r1 % n in r1. Returns an error at initialisation time if n is 0
-func (a *ALU) modImmediate(r1 registerID, p2 interface{}) error {
-	// the compiler will prevent n == 0
-	n := p2.(int)
+	case opModulo:
+		if n == 0 {
+			return errModulo(inst)
+		}
+		*r %= n
 
-	mod := a.get(r1) % n
-	a.set(r1, mod)
-	return nil
-}
+	case opEquals:
+		if *r == n {
+			*r = 1
+		} else {
+			*r = 0
+		}
 
-// eqRegister stores 1 or 0 in r1 depending on if the value in
-// r1 equals the value in r2. (1 for true, 0 for false)
-func (a *ALU) eqRegister(r1 registerID, p2 interface{}) error {
-	r2 := p2.(registerID)
+	case opJumpNotZero:
+		if *r != 0 {
+			a.pc = n
+			return nil
+		}
+
+	case opJump:
+		a.pc = n
+		return nil
+
+	case opCall:
+		if len(a.stack) == MaxCallDepth {
+			return errors.Errorf("execution failed on %s: call stack overflow", inst.where())
+		}
+		a.stack = append(a.stack, a.pc+1)
+		a.pc = n
+		return nil
 
-	if a.get(r1) == a.get(r2) {
-		a.set(r1, 1)
+	case opReturn:
+		if len(a.stack) == 0 {
+			return errors.Errorf("execution failed on %s: return without a call", inst.where())
+		}
+		a.pc = a.stack[len(a.stack)-1]
+		a.stack = a.stack[:len(a.stack)-1]
 		return nil
 	}
 
-	a.set(r1, 0)
+	a.pc++
 	return nil
 }
 
-// eqImmediate stores 1 in r1 iff the value in r1 == n.
-func (a *ALU) eqImmediate(r1 registerID, p2 interface{}) error {
-	n := p2.(int)
-
-	if a.get(r1) == n {
-		a.set(r1, 1)
-		return nil
+// read the next value from the ALU's input, for the given inp instruction.
+func (a *ALU) read(inst *instruction) (int, error) {
+	n, err := a.in.Next()
+	switch {
+	case err == io.EOF:
+		return 0, &EndOfInputError{File: inst.src.instFile(), Line: inst.line}
+	case err != nil:
+		return 0, errors.Wrapf(err, "execution failed on %s", inst.where())
 	}
+	a.consumed = append(a.consumed, n)
+	return n, nil
+}
 
-	a.set(r1, 0)
-	return nil
+// errDivide is returned when a div instruction would divide by 0.
+func errDivide(inst *instruction) error {
+	return errors.Errorf("execution failed on %s: divide by 0", inst.where())
+}
+
+// errModulo is returned when a mod instruction would divide by 0.
+func errModulo(inst *instruction) error {
+	return errors.Errorf("execution failed on %s: modulo of 0 is undefined", inst.where())
 }
 
 // get returns the value of the given register.
 func (a *ALU) get(reg registerID) int {
-	return a.reg[reg-regW]
+	return a.reg[reg]
 }
 
 // set the given register to the given value.
 func (a *ALU) set(reg registerID, n int) {
-	a.reg[reg-regW] = n
-}
-
-// getFunctionName is used during tracing
-func getFunctionName(i interface{}) string {
-	name := runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
-	return strings.TrimPrefix(name, "github.com/nealmcc/aoc2021/pkg/alu.(*ALU).")
+	a.reg[reg] = n
 }
@@ -1,19 +1,24 @@
 package alu
 
 import (
-	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/zap/zaptest"
 )
 
 func TestRun(t *testing.T) {
 	tt := []struct {
 		name      string
 		program   string
-		input     []byte
+		input     []int
 		output    int
 		wantErr   bool
 		registers [4]int
@@ -32,7 +37,7 @@ mod x 2
 div w 2
 mod w 2
 `,
-			input:     []byte{15},
+			input:     []int{15},
 			output:    1,
 			registers: [4]int{1, 1, 1, 1},
 		},
@@ -47,9 +52,11 @@ mod w 2
 			r.NoError(err)
 			alu := New(code)
 
-			alu.EnableTrace(zaptest.NewLogger(t).Sugar())
+			alu.SetTracer(TracerFunc(func(ev TraceEvent) {
+				t.Logf("line %d: %-12s %+v", ev.Line, ev.Instruction(), ev.After)
+			}))
 
-			got, err := alu.Run(bytes.NewReader(tc.input))
+			got, err := alu.Run(Ints(tc.input...))
 			if tc.wantErr {
 				r.Error(err)
 			} else {
@@ -58,8 +65,189 @@ mod w 2
 			}
 
 			for i := 0; i < 4; i++ {
-				a.Equal(tc.registers[i], alu.reg[i], "register %c", byte(i)+byte(regW))
+				a.Equal(tc.registers[i], alu.reg[i], "register %s", registerID(i))
 			}
 		})
 	}
 }
+
+func TestRun_controlFlow(t *testing.T) {
+	tt := []struct {
+		name    string
+		program string
+		input   []int
+		want    int
+		wantErr string
+	}{
+		{
+			name: "multiply by repeated addition",
+			program: `inp w
+inp x
+loop:
+  add z w
+  add x -1
+  jnz x loop
+`,
+			input: []int{6, 7},
+			want:  42,
+		},
+		{
+			name: "call a subroutine twice",
+			program: `inp w
+call double
+call double
+jmp end
+double:
+  mul w 2
+  ret
+end:
+add z w
+`,
+			input: []int{5},
+			want:  20,
+		},
+		{
+			name:    "unbounded recursion",
+			program: "f: call f\n",
+			wantErr: "execution failed on line 1: call stack overflow",
+		},
+		{
+			name:    "return without a call",
+			program: "add z 1\nret\n",
+			wantErr: "execution failed on line 2: return without a call",
+		},
+		{
+			name:    "jumping to the end stops the program",
+			program: "add z 3\njmp end\nadd z 4\nend:\n",
+			want:    3,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			// run each program without checks, with a budget (which
+			// executes in chunks), and with tracing:
+			for mode := 0; mode < 3; mode++ {
+				calc := New(code)
+				switch mode {
+				case 1:
+					calc.SetBudget(100000)
+				case 2:
+					calc.SetTracer(NewProfile())
+				}
+
+				got, err := calc.Run(Ints(tc.input...))
+				if tc.wantErr != "" {
+					r.EqualError(err, tc.wantErr, "mode %d", mode)
+					continue
+				}
+				r.NoError(err, "mode %d", mode)
+				r.Equal(tc.want, got, "mode %d", mode)
+			}
+		})
+	}
+}
+
+func TestRunContext_infiniteLoop(t *testing.T) {
+	code, err := Compile([]byte("loop: add z 1\njmp loop\n"))
+	require.NoError(t, err)
+
+	calc := New(code)
+	calc.SetBudget(1001)
+	_, err = calc.Run(Ints())
+	require.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.Equal(t, Registers{Z: 501}, calc.Snapshot().Registers)
+
+	calc.SetBudget(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = calc.RunContext(ctx, Ints())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestExecuteFast_vs_step runs random programs through both interpreters,
+// which must always agree. The programs are biased towards sequences of
+// instructions that the fast interpreter fuses together.
+func TestExecuteFast_vs_step(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+
+	randOperand := func() string {
+		if rng.Intn(2) == 0 {
+			return string(registerNames[rng.Intn(4)])
+		}
+		return strconv.Itoa(rng.Intn(7) - 3)
+	}
+
+	for n := 0; n < 2000; n++ {
+		var src strings.Builder
+		for i := 0; i < 30; i++ {
+			r := string(registerNames[rng.Intn(4)])
+			switch rng.Intn(6) {
+			case 0:
+				fmt.Fprintf(&src, "inp %s\n", r)
+			case 1:
+				fmt.Fprintf(&src, "mul %s 0\nadd %s %s\n", r, r, randOperand())
+				if rng.Intn(2) == 0 {
+					fmt.Fprintf(&src, "add %s %d\n", r, rng.Intn(20))
+				}
+			case 2:
+				fmt.Fprintf(&src, "eql %s %s\neql %s 0\n", r, randOperand(), r)
+			case 3:
+				fmt.Fprintf(&src, "mul %s %s\nadd %s %d\n", r, randOperand(), r, rng.Intn(5))
+			default:
+				op := []string{"add", "mul", "div", "mod", "eql"}[rng.Intn(5)]
+				p2 := randOperand()
+				if p2 == "0" && (op == "div" || op == "mod") {
+					p2 = "7"
+				}
+				fmt.Fprintf(&src, "%s %s %s\n", op, r, p2)
+			}
+		}
+
+		code, err := Compile([]byte(src.String()))
+		require.NoError(t, err)
+
+		in := make([]int, 8+rng.Intn(8))
+		for i := range in {
+			in[i] = rng.Intn(5)
+		}
+
+		fast := New(code)
+		gotZ, gotErr := fast.Run(Ints(in...))
+
+		slow := New(code)
+		slow.SetTracer(NewProfile())
+		wantZ, wantErr := slow.Run(Ints(in...))
+
+		require.Equal(t, wantErr == nil, gotErr == nil, "program:\n%s", src.String())
+		if wantErr != nil {
+			require.Equal(t, wantErr.Error(), gotErr.Error())
+		} else {
+			require.Equal(t, wantZ, gotZ)
+		}
+		require.Equal(t, slow.reg, fast.reg, "program:\n%s\ninput: %v", src.String(), in)
+	}
+}
+
+func BenchmarkRun_day24(b *testing.B) {
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	require.NoError(b, err)
+
+	code, err := Compile(src)
+	require.NoError(b, err)
+
+	calc := New(code)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := calc.Run(Digits("13579246897531")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package alu
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -11,143 +9,360 @@ import (
 
 // Compile interprets the given program code, checks it for syntax errors,
 // and generates a sequence of instructions for the ALU to execute when it runs.
+//
+// Each line holds at most one instruction. Blank lines are ignored, and a '#'
+// starts a comment that runs to the end of the line. If the code has any
+// syntax errors, Compile reports all of them in an ErrorList.
+//
+// A line may start with one or more labels, such as 'loop:', which name the
+// next instruction. The jmp, jnz and call instructions take a label as their
+// target. A label at the end of the program names the end, so jumping to it
+// stops the program.
+//
+// The source may also define constants and macros, as described for
+// CompileFS. Only CompileFS can include other files.
 func Compile(code []byte) (Program, error) {
-	buf := bytes.NewBuffer(code)
-	instructions := make([]instruction, 0, 128)
+	return compile(newPreprocessor(nil, newLexer(code)))
+}
 
-	for line := 1; true; line++ {
-		var (
-			text []byte
-			inst instruction
-			err  error
-		)
-		inst.line = line
-
-		if text, err = buf.ReadBytes('\n'); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, errors.WithMessagef(err, "line %d", line)
-		}
+// compile parses the tokens from the preprocessor into a program.
+func compile(pre *preprocessor) (Program, error) {
+	p := parser{pre: pre, labels: make(map[string]labelDef)}
+	pre.errs = &p.errs
+	p.advance()
 
-		// make it so I can comment out irrelevant code, and add blank lines
-		if text[0] == '#' || text[0] == '\n' {
-			continue
+	instructions := make([]instruction, 0, 128)
+	for p.tok.kind != tokEOF {
+		p.count = len(instructions)
+		refs := len(p.refs)
+		if inst, ok := p.parseLine(); ok {
+			instructions = append(instructions, inst)
+		} else {
+			// the line has no instruction, so nor can it use a label.
+			p.refs = p.refs[:refs]
 		}
+	}
 
-		if inst.r1, err = parseR1(text[4]); err != nil {
-			return nil, errors.WithMessagef(err, "line %d", line)
-		}
+	p.resolve(instructions)
 
-		if inst.p2, err = parseP2(text[5:]); err != nil {
-			return nil, errors.WithMessagef(err, "line %d", line)
-		}
+	if err := p.errs.Err(); err != nil {
+		p.errs.sort(pre.order)
+		return nil, err
+	}
+	return instructions, nil
+}
 
-		if inst.fn, err = chooseOperation(text[:3], inst.p2); err != nil {
-			return nil, errors.WithMessagef(err, "line %d", line)
-		}
+// parser reads tokens from a lexer and assembles them into instructions.
+type parser struct {
+	pre    *preprocessor
+	tok    token // tok is the current token
+	errs   ErrorList
+	count  int                 // count is the number of instructions so far.
+	labels map[string]labelDef // labels holds every label defined so far.
+	refs   []labelRef          // refs holds every use of a label.
+}
 
-		instructions = append(instructions, inst)
-	}
+// labelDef records where a label was defined.
+type labelDef struct {
+	index int   // index is the index of the instruction that it names.
+	tok   token // tok is the label's name, for error messages.
+}
 
-	return instructions, nil
+// labelRef records an instruction that uses a label as its target.
+type labelRef struct {
+	index int
+	tok   token
 }
 
-// opcode is the identifier for an arithmetic operation
-type opcode string
+// advance moves on to the next token.
+func (p *parser) advance() {
+	p.tok = p.pre.next()
+}
 
-const (
-	opInput    opcode = "inp"
-	opAdd      opcode = "add"
-	opMultiply opcode = "mul"
-	opDivide   opcode = "div"
-	opModulo   opcode = "mod"
-	opEquals   opcode = "eql"
-)
+// parseLine parses a single line of source, including its terminating
+// newline. It returns false if the line has no instruction or has an error.
+func (p *parser) parseLine() (instruction, bool) {
+	var inst instruction
 
-func chooseOperation(code []byte, p2 interface{}) (operation, error) {
-	_, useRegister := p2.(registerID)
+	if p.tok.kind == tokNewline {
+		p.advance()
+		return inst, false
+	}
 
-	switch opcode(code) {
-	case opInput:
-		return (*ALU).input, nil
+	first := p.tok
+	if first.kind != tokIdent {
+		return inst, p.fail(first, "expected opcode or label, found %s", describe(first))
+	}
+	p.advance()
+
+	for p.tok.kind == tokColon {
+		p.defineLabel(first)
+		p.advance()
 
-	case opAdd:
-		if useRegister {
-			return (*ALU).addRegister, nil
+		switch p.tok.kind {
+		case tokNewline, tokEOF:
+			p.advance()
+			return inst, false
+		case tokIdent:
+			first = p.tok
+			p.advance()
+		default:
+			return inst, p.fail(p.tok, "expected opcode or label, found %s", describe(p.tok))
 		}
-		return (*ALU).addImmediate, nil
+	}
+
+	inst.line = first.line
+	if first.src != nil && first.src.expansion != "" {
+		// code from a macro has the line where the macro was used:
+		inst.line = first.src.callLine
+	}
+	op, ok := parseOpcode(first.text)
+	if !ok {
+		return inst, p.fail(first, "unrecognised opcode %q", first.text)
+	}
 
-	case opMultiply:
-		if useRegister {
-			return (*ALU).mulRegister, nil
+	var err error
+	if op.hasR1() {
+		if inst.r1, err = p.parseR1(); err != nil {
+			return inst, false
 		}
-		return (*ALU).mulImmediate, nil
+	}
 
-	case opDivide:
-		if useRegister {
-			return (*ALU).divRegister, nil
+	switch {
+	case op.isJump():
+		if inst.p2, err = p.parseTarget(); err != nil {
+			return inst, false
+		}
+	case op != opInput && op != opReturn:
+		if inst.p2, err = p.parseP2(); err != nil {
+			return inst, false
 		}
-		if n := p2.(int); n == 0 {
-			return nil, errors.New("divide by 0")
+	}
+
+	if p.tok.kind != tokNewline && p.tok.kind != tokEOF {
+		return inst, p.fail(p.tok, "unexpected %s after %s instruction",
+			describe(p.tok), first.text)
+	}
+	p.advance()
+
+	if inst, err = newInstruction(op, inst.r1, inst.p2, inst.line); err != nil {
+		p.errs.add(first, "%s", err)
+		return inst, false
+	}
+	inst.src = first.src
+
+	return inst, true
+}
+
+// defineLabel records that the given label names the next instruction.
+func (p *parser) defineLabel(name token) {
+	if prev, ok := p.labels[name.text]; ok {
+		p.errs.add(name, "label %q is already defined on %s",
+			name.text, prev.tok.src.position(prev.tok.line))
+		return
+	}
+	p.labels[name.text] = labelDef{index: p.count, tok: name}
+}
+
+// parseTarget parses the target of a jump or call, which must be a label.
+// The label may be defined later, so the target is resolved at the end.
+func (p *parser) parseTarget() (operand, error) {
+	tok := p.tok
+	if tok.kind != tokIdent {
+		p.fail(tok, "expected label, found %s", describe(tok))
+		return operand{}, errSkipped
+	}
+	p.refs = append(p.refs, labelRef{index: p.count, tok: tok})
+	p.advance()
+	return targetOperand(tok.text, -1), nil
+}
+
+// resolve sets the target of every jump and call to the index of the
+// instruction named by its label, and reports any undefined labels.
+func (p *parser) resolve(code Program) {
+	for _, ref := range p.refs {
+		def, ok := p.labels[ref.tok.text]
+		if !ok {
+			p.errs.add(ref.tok, "undefined label %q", ref.tok.text)
+			continue
 		}
-		return (*ALU).divImmediate, nil
+		code[ref.index].p2.n = def.index
+	}
+}
 
-	case opModulo:
-		if useRegister {
-			return (*ALU).modRegister, nil
+// newInstruction assembles an instruction from its opcode and operands.
+// Returns an error if the instruction would always divide by zero.
+func newInstruction(op opcode, r1 registerID, p2 operand, line int) (instruction, error) {
+	if n, ok := p2.isImmediate(); ok && n == 0 {
+		switch op {
+		case opDivide:
+			return instruction{}, errors.New("divide by 0")
+		case opModulo:
+			return instruction{}, errors.New("modulo of 0 is undefined")
 		}
-		if n := p2.(int); n == 0 {
-			return nil, errors.New("divide by 0")
+	}
+	return instruction{op: op, r1: r1, p2: p2, line: line, exec: dispatchCode(op, r1, p2)}, nil
+}
+
+// parseR1 parses the first operand of an instruction, which must be a register.
+func (p *parser) parseR1() (registerID, error) {
+	tok := p.tok
+	if tok.kind != tokIdent {
+		p.fail(tok, "expected register, found %s", describe(tok))
+		return 0, errSkipped
+	}
+
+	r1, err := parseR1(tok.text)
+	if err != nil {
+		p.fail(tok, "%s: %q", err, tok.text)
+		return 0, errSkipped
+	}
+
+	p.advance()
+	return r1, nil
+}
+
+// parseP2 parses the second operand of an instruction, which is either
+// a register or an integer.
+func (p *parser) parseP2() (operand, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokIdent:
+		r2, err := parseR1(tok.text)
+		if err != nil {
+			p.fail(tok, "%s: %q", err, tok.text)
+			return operand{}, errSkipped
 		}
-		return (*ALU).modImmediate, nil
+		p.advance()
+		return regOperand(r2), nil
 
-	case opEquals:
-		if useRegister {
-			return (*ALU).eqRegister, nil
+	case tokNumber:
+		n, err := strconv.Atoi(tok.text)
+		if err != nil {
+			p.fail(tok, "cannot parse second parameter: %q is out of range", tok.text)
+			return operand{}, errSkipped
 		}
-		return (*ALU).eqImmediate, nil
+		p.advance()
+		return immOperand(n), nil
 
 	default:
-		return nil, fmt.Errorf("unrecognised opcode %q", code)
+		p.fail(tok, "expected register or number, found %s", describe(tok))
+		return operand{}, errSkipped
 	}
 }
 
-// parseR1 checks to ensure that b is a register ID,
-// and returns an error if it isn't.
-func parseR1(b byte) (registerID, error) {
-	if !isRegisterID(b) {
-		return 0, errors.New("not a register ID")
+// fail records an error at the given token, and then skips ahead to the
+// start of the next line so that parsing can continue.
+// It always returns false, for the convenience of the caller.
+func (p *parser) fail(at token, format string, args ...interface{}) bool {
+	p.errs.add(at, format, args...)
+	for p.tok.kind != tokNewline && p.tok.kind != tokEOF {
+		p.advance()
 	}
-	return registerID(b), nil
+	p.advance()
+	return false
 }
 
-// parseP2 parses the second parameter to an instruction, returning either
-// a registerID or an integer.  If the value cannot be parsed as either of
-// these, then an error is returned.
-func parseP2(b []byte) (interface{}, error) {
-	b = bytes.TrimSpace(b)
-	if len(b) == 0 {
-		return nil, nil
+// errSkipped signals that the parser has already recorded an error and
+// skipped the rest of the line.
+var errSkipped = errors.New("skipped")
+
+// describe a token for use in an error message.
+func describe(tok token) string {
+	switch tok.kind {
+	case tokIdent, tokNumber, tokIllegal:
+		return fmt.Sprintf("%s %q", tok.kind, tok.text)
+	default:
+		return tok.kind.String()
 	}
+}
+
+// opcode is the identifier for an arithmetic operation
+type opcode byte
+
+const (
+	opInput opcode = iota
+	opAdd
+	opMultiply
+	opDivide
+	opModulo
+	opEquals
 
-	if len(b) == 1 && isRegisterID(b[0]) {
-		return registerID(b[0]), nil
+	// control flow:
+	opJumpNotZero
+	opJump
+	opCall
+	opReturn
+)
+
+// opcodeNames holds the mnemonic used in source code for each opcode.
+var opcodeNames = [...]string{
+	opInput:       "inp",
+	opAdd:         "add",
+	opMultiply:    "mul",
+	opDivide:      "div",
+	opModulo:      "mod",
+	opEquals:      "eql",
+	opJumpNotZero: "jnz",
+	opJump:        "jmp",
+	opCall:        "call",
+	opReturn:      "ret",
+}
+
+// isControl checks if the opcode changes which instruction runs next.
+func (op opcode) isControl() bool {
+	return op >= opJumpNotZero
+}
+
+// isJump checks if the opcode takes a label as its target.
+func (op opcode) isJump() bool {
+	return op == opJumpNotZero || op == opJump || op == opCall
+}
+
+// hasR1 checks if the opcode takes a register as its first operand.
+func (op opcode) hasR1() bool {
+	return !op.isControl() || op == opJumpNotZero
+}
+
+// String implements fmt.Stringer, returning the opcode's mnemonic.
+func (op opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
 	}
+	return fmt.Sprintf("opcode(%d)", byte(op))
+}
 
-	n, err := strconv.Atoi(string(b))
-	if err != nil {
-		return nil, errors.Wrap(err, "cannot parse second parameter")
+// straightLine returns an error if the program has any control flow, for
+// the analyses that only understand straight-line code.
+func straightLine(code Program) error {
+	for _, inst := range code {
+		if inst.op.isControl() {
+			return errors.Errorf("line %d: %s instructions are not supported", inst.line, inst.op)
+		}
 	}
-	return n, nil
+	return nil
 }
 
-// isRegisterID ensures the given byte is a valid register ID. Used during compilation.
-func isRegisterID(b byte) bool {
-	switch registerID(b) {
-	case regW, regX, regY, regZ:
-		return true
-	default:
-		return false
+// parseOpcode finds the opcode with the given mnemonic, and returns false
+// if there isn't one.
+func parseOpcode(text string) (opcode, bool) {
+	for op, name := range opcodeNames {
+		if name == text {
+			return opcode(op), true
+		}
+	}
+	return 0, false
+}
+
+// parseR1 checks to ensure that text is a register ID,
+// and returns an error if it isn't.
+func parseR1(text string) (registerID, error) {
+	if len(text) == 1 {
+		for r, name := range registerNames {
+			if text[0] == name {
+				return registerID(r), nil
+			}
+		}
 	}
+	return 0, errors.New("not a register ID")
 }
@@ -79,6 +79,51 @@ func TestCompile(t *testing.T) {
 			in:        "eql y -42\n",
 			wantCount: 1,
 		},
+		{
+			name:      "ignores tabs, extra spaces and CRLF line endings",
+			in:        "inp\tw\r\n  add   x  w \r\n",
+			wantCount: 2,
+		},
+		{
+			name:      "ignores comments and blank lines",
+			in:        "# header\n\ninp w # read a digit\n   \nmul x 0#no space\n",
+			wantCount: 2,
+		},
+		{
+			name:      "does not require a final newline",
+			in:        "inp w\nadd x w",
+			wantCount: 2,
+		},
+		{
+			name:    "rejects a short line",
+			in:      "in\n",
+			wantErr: true,
+		},
+		{
+			name:    "rejects a missing operand",
+			in:      "add x\n",
+			wantErr: true,
+		},
+		{
+			name:    "rejects an extra operand",
+			in:      "inp w 3\n",
+			wantErr: true,
+		},
+		{
+			name:      "can parse labels, jumps and calls",
+			in:        "top:\njnz x top\njmp end\ncall top\nret\nend:\n",
+			wantCount: 4,
+		},
+		{
+			name:      "can parse several labels before an instruction",
+			in:        "a: b: add x 1\njmp a\njmp b\n",
+			wantCount: 3,
+		},
+		{
+			name:    "rejects a register after ret",
+			in:      "ret x\n",
+			wantErr: true,
+		},
 	}
 
 	for _, tc := range tt {
@@ -97,3 +142,97 @@ func TestCompile(t *testing.T) {
 		})
 	}
 }
+
+func TestCompile_reportsAllErrors(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	src := "inp w\n" +
+		"add q 1\n" +
+		"mul x\n" +
+		"\tdiv y 0 # oops\n" +
+		"foo x y\n" +
+		"eql x 99999999999999999999\n" +
+		"mod x $\n" +
+		"add x y\n"
+
+	_, err := Compile([]byte(src))
+	r.Error(err)
+
+	var list ErrorList
+	r.ErrorAs(err, &list)
+
+	want := ErrorList{
+		{Line: 2, Col: 5, Msg: `not a register ID: "q"`},
+		{Line: 3, Col: 6, Msg: "expected register or number, found end of line"},
+		{Line: 4, Col: 2, Msg: "divide by 0"},
+		{Line: 5, Col: 1, Msg: `unrecognised opcode "foo"`},
+		{Line: 6, Col: 7, Msg: `cannot parse second parameter: "99999999999999999999" is out of range`},
+		{Line: 7, Col: 7, Msg: `expected register or number, found illegal character "$"`},
+	}
+	a.Equal(want, list)
+	a.Equal(`line 2, col 5: not a register ID: "q" (and 5 more errors)`, err.Error())
+}
+
+func TestCompile_labelErrors(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	src := "loop: add x 1\n" +
+		"jnz x 3\n" +
+		"jmp nowhere\n" +
+		"loop:\n" +
+		"call\n" +
+		"jnz loop\n" +
+		"7: add x 1\n"
+
+	_, err := Compile([]byte(src))
+	var list ErrorList
+	r.ErrorAs(err, &list)
+
+	want := ErrorList{
+		{Line: 2, Col: 7, Msg: `expected label, found number "3"`},
+		{Line: 3, Col: 5, Msg: `undefined label "nowhere"`},
+		{Line: 4, Col: 1, Msg: `label "loop" is already defined on line 1`},
+		{Line: 5, Col: 5, Msg: "expected label, found end of line"},
+		{Line: 6, Col: 5, Msg: `not a register ID: "loop"`},
+		{Line: 7, Col: 1, Msg: `expected opcode or label, found number "7"`},
+	}
+	a.Equal(want, list)
+}
+
+func TestCompile_jumpWithTrailingInput(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		want ErrorList
+	}{
+		{
+			name: "first line",
+			in:   "jmp a extra\na:\n",
+			want: ErrorList{{Line: 1, Col: 7, Msg: `unexpected identifier "extra" after jmp instruction`}},
+		},
+		{
+			name: "after another instruction",
+			in:   "add x 1\njmp a b\na:\n",
+			want: ErrorList{{Line: 2, Col: 7, Msg: `unexpected identifier "b" after jmp instruction`}},
+		},
+		{
+			name: "undefined label",
+			in:   "jnz x nowhere extra\n",
+			want: ErrorList{{Line: 1, Col: 15, Msg: `unexpected identifier "extra" after jnz instruction`}},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, a := require.New(t), assert.New(t)
+
+			var list ErrorList
+			r.NotPanics(func() {
+				_, err := Compile([]byte(tc.in))
+				r.ErrorAs(err, &list)
+			})
+			a.Equal(tc.want, list)
+		})
+	}
+}
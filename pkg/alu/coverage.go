@@ -0,0 +1,183 @@
+package alu
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Coverage is a Tracer that records which instructions of a program have
+// run, and which outcomes each eql and jnz instruction has had. Attach it
+// to an ALU with SetTracer, where it can stay for any number of runs, to
+// measure the coverage of a whole test suite.
+type Coverage struct {
+	code  Program
+	lines []LineCoverage // lines is indexed by the instruction's PC.
+}
+
+// LineCoverage is the coverage of a single instruction.
+type LineCoverage struct {
+	Line        int
+	Instruction string
+	Count       int // Count is the number of times the instruction ran.
+
+	// Branch is true for eql and jnz instructions, which have two outcomes.
+	// True counts the times that eql found its operands equal, or that jnz
+	// jumped, and False counts the other outcome.
+	Branch      bool
+	True, False int
+}
+
+// Covered returns how many of the instruction's outcomes have been seen, out
+// of how many it has: an eql or jnz has two outcomes, and any other
+// instruction has one.
+func (lc LineCoverage) Covered() (seen, total int) {
+	if !lc.Branch {
+		if lc.Count > 0 {
+			return 1, 1
+		}
+		return 0, 1
+	}
+	if lc.True > 0 {
+		seen++
+	}
+	if lc.False > 0 {
+		seen++
+	}
+	return seen, 2
+}
+
+// NewCoverage makes an empty coverage report for the program. The program
+// must be the same one that the traced ALU runs.
+func NewCoverage(code Program) *Coverage {
+	c := &Coverage{code: code, lines: make([]LineCoverage, len(code))}
+	for i, inst := range code {
+		c.lines[i] = LineCoverage{
+			Line:        inst.line,
+			Instruction: inst.String(),
+			Branch:      inst.op == opEquals || inst.op == opJumpNotZero,
+		}
+	}
+	return c
+}
+
+// Trace implements Tracer.
+func (c *Coverage) Trace(ev TraceEvent) {
+	lc := &c.lines[ev.PC]
+	lc.Count++
+	if !lc.Branch || ev.Err != nil {
+		return
+	}
+
+	var outcome bool
+	switch ev.inst.op {
+	case opEquals:
+		outcome = ev.After.get(ev.inst.r1) == 1
+	case opJumpNotZero:
+		outcome = ev.Before.get(ev.inst.r1) != 0
+	}
+	if outcome {
+		lc.True++
+	} else {
+		lc.False++
+	}
+}
+
+// get returns the value of the given register.
+func (r Registers) get(reg registerID) int {
+	return [...]int{r.W, r.X, r.Y, r.Z}[reg&3]
+}
+
+// Lines returns the coverage of every instruction, in program order.
+func (c *Coverage) Lines() []LineCoverage {
+	return append([]LineCoverage(nil), c.lines...)
+}
+
+// Summary returns how many instructions have run, and how many of the
+// outcomes of eql and jnz instructions have been seen.
+func (c *Coverage) Summary() (lines, totalLines, branches, totalBranches int) {
+	for _, lc := range c.lines {
+		totalLines++
+		if lc.Count > 0 {
+			lines++
+		}
+		if lc.Branch {
+			seen, total := lc.Covered()
+			branches += seen
+			totalBranches += total
+		}
+	}
+	return lines, totalLines, branches, totalBranches
+}
+
+// WriteTo writes the coverage as a table in program order, with a line of
+// totals at the end. It implements io.WriterTo.
+func (c *Coverage) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "line\tcount\ttrue\tfalse\t\t\n")
+	for _, lc := range c.lines {
+		if lc.Branch {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\t%s\n", lc.Line, lc.Count, lc.True, lc.False, lc.Instruction)
+		} else {
+			fmt.Fprintf(tw, "%d\t%d\t\t\t\t%s\n", lc.Line, lc.Count, lc.Instruction)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return cw.n, err
+	}
+
+	lines, totalLines, branches, totalBranches := c.Summary()
+	_, err := fmt.Fprintf(cw, "%s of instructions, %s of branch outcomes\n",
+		percent(lines, totalLines), percent(branches, totalBranches))
+	return cw.n, err
+}
+
+// percent formats n out of total as a percentage.
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// WriteProfile writes the coverage in the format of a Go cover profile,
+// with "count" mode, so that it can be read by tools that understand them.
+// Each instruction is a block holding one statement, and name is the file
+// name for instructions that were not compiled by CompileFS.
+//
+// The columns of each block assume the source has the layout written by
+// MarshalText. An eql or jnz is written as two blocks, one for each
+// outcome: the block up to its last operand counts the true outcome, and
+// the block of its last operand counts the false outcome.
+func (c *Coverage) WriteProfile(w io.Writer, name string) error {
+	if _, err := fmt.Fprintln(w, "mode: count"); err != nil {
+		return err
+	}
+
+	labels := c.code.labels()
+	for i, lc := range c.lines {
+		inst := c.code[i]
+		file := name
+		if inst.src != nil && inst.src.file != "" {
+			file = inst.src.file
+		}
+
+		start := len(labels[i]) + 1
+		end := start + len(lc.Instruction)
+		var err error
+		if lc.Branch {
+			split := end - len(inst.p2.String())
+			_, err = fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n%s:%d.%d,%d.%d 1 %d\n",
+				file, lc.Line, start, lc.Line, split, lc.True,
+				file, lc.Line, split, lc.Line, end, lc.False)
+		} else {
+			_, err = fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n",
+				file, lc.Line, start, lc.Line, end, lc.Count)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package alu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const coverageProgram = `inp w
+eql w 3
+jnz w skip
+mul z 2
+jmp end
+skip: add z 1
+end: add x 1
+`
+
+func TestCoverage(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(coverageProgram))
+	r.NoError(err)
+
+	cover := NewCoverage(code)
+	calc := New(code)
+	calc.SetTracer(cover)
+	for _, in := range []int{1, 2} {
+		_, err = calc.Run(Ints(in))
+		r.NoError(err)
+	}
+
+	a.Equal([]LineCoverage{
+		{Line: 1, Instruction: "inp w", Count: 2},
+		{Line: 2, Instruction: "eql w 3", Count: 2, Branch: true, False: 2},
+		{Line: 3, Instruction: "jnz w skip", Count: 2, Branch: true, False: 2},
+		{Line: 4, Instruction: "mul z 2", Count: 2},
+		{Line: 5, Instruction: "jmp end", Count: 2},
+		{Line: 6, Instruction: "add z 1"},
+		{Line: 7, Instruction: "add x 1", Count: 2},
+	}, cover.Lines())
+
+	lines, totalLines, branches, totalBranches := cover.Summary()
+	a.Equal([]int{6, 7, 2, 4}, []int{lines, totalLines, branches, totalBranches})
+
+	_, err = calc.Run(Ints(3))
+	r.NoError(err)
+
+	buf := new(strings.Builder)
+	n, err := cover.WriteTo(buf)
+	r.NoError(err)
+	a.Equal(int64(buf.Len()), n)
+	var rows [][]string
+	for _, row := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rows = append(rows, strings.Fields(row))
+	}
+	a.Equal([][]string{
+		{"line", "count", "true", "false"},
+		{"1", "3", "inp", "w"},
+		{"2", "3", "1", "2", "eql", "w", "3"},
+		{"3", "3", "1", "2", "jnz", "w", "skip"},
+		{"4", "2", "mul", "z", "2"},
+		{"5", "2", "jmp", "end"},
+		{"6", "1", "add", "z", "1"},
+		{"7", "3", "add", "x", "1"},
+		{"100.0%", "of", "instructions,", "100.0%", "of", "branch", "outcomes"},
+	}, rows)
+
+	buf.Reset()
+	r.NoError(cover.WriteProfile(buf, "program.alu"))
+	a.Equal(`mode: count
+program.alu:1.1,1.6 1 3
+program.alu:2.1,2.7 1 1
+program.alu:2.7,2.8 1 2
+program.alu:3.1,3.7 1 1
+program.alu:3.7,3.11 1 2
+program.alu:4.1,4.8 1 2
+program.alu:5.1,5.8 1 2
+program.alu:6.7,6.14 1 1
+program.alu:7.6,7.13 1 3
+`, buf.String())
+}
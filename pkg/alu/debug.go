@@ -0,0 +1,275 @@
+package alu
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Debugger runs a program one instruction at a time, so that its registers
+// can be inspected as it goes. It remembers every step it takes, so that it
+// can also step backwards.
+//
+// A Debugger is not safe for concurrent use.
+type Debugger struct {
+	alu     *ALU
+	history []debugFrame // history holds the state before each step.
+	err     error        // err is the error from the most recent step.
+
+	in *replay
+
+	breaks  map[int]struct{}
+	watches [4]bool
+}
+
+// debugFrame is the state of the debugger before a single step.
+// A step changes at most the top of the call stack, so only the depth
+// and the top are saved.
+type debugFrame struct {
+	pc    int
+	reg   [4]int
+	next  int
+	depth int
+	top   int
+}
+
+// StopReason explains why Continue returned.
+type StopReason int
+
+const (
+	// StopEnd means the program ran to completion.
+	StopEnd StopReason = iota
+
+	// StopBreakpoint means the next instruction is on a breakpoint's line.
+	StopBreakpoint
+
+	// StopWatchpoint means the last instruction changed a watched register.
+	StopWatchpoint
+
+	// StopError means the next instruction failed.
+	StopError
+)
+
+var stopReasonNames = [...]string{
+	StopEnd:        "end",
+	StopBreakpoint: "breakpoint",
+	StopWatchpoint: "watchpoint",
+	StopError:      "error",
+}
+
+// String implements fmt.Stringer.
+func (r StopReason) String() string {
+	return stopReasonNames[r]
+}
+
+// ErrFinished is returned when stepping past the end of the program.
+var ErrFinished = errors.New("the program has finished")
+
+// ErrNoHistory is returned when stepping back from the start of the program.
+var ErrNoHistory = errors.New("already at the start of the program")
+
+// NewDebugger prepares to debug the given program, which will read from in.
+// The registers start at 0, and nothing runs until the first step.
+func NewDebugger(code Program, in Input) *Debugger {
+	d := &Debugger{
+		alu:    &ALU{code: code},
+		in:     &replay{in: in},
+		breaks: make(map[int]struct{}),
+	}
+	d.alu.in = d.in
+	return d
+}
+
+// replay is an Input that remembers every value it reads, so that the
+// debugger can rewind it after stepping backwards.
+type replay struct {
+	in   Input
+	read []int // read holds every value read from in so far.
+	next int   // next is the index in read of the next value to use.
+}
+
+// Next implements Input.
+func (r *replay) Next() (int, error) {
+	if r.next == len(r.read) {
+		n, err := r.in.Next()
+		if err != nil {
+			return 0, err
+		}
+		r.read = append(r.read, n)
+	}
+	n := r.read[r.next]
+	r.next++
+	return n, nil
+}
+
+// Step executes the next instruction. If the instruction fails, Step returns
+// the error and stays on that instruction.
+func (d *Debugger) Step() error {
+	if d.Finished() {
+		return ErrFinished
+	}
+
+	frame := debugFrame{pc: d.alu.pc, reg: d.alu.reg, next: d.in.next, depth: len(d.alu.stack)}
+	if frame.depth > 0 {
+		frame.top = d.alu.stack[frame.depth-1]
+	}
+
+	if d.err = d.alu.step(); d.err != nil {
+		d.in.next = frame.next
+		return d.err
+	}
+
+	d.history = append(d.history, frame)
+	return nil
+}
+
+// StepBack undoes the most recent step, including any input it read.
+func (d *Debugger) StepBack() error {
+	if len(d.history) == 0 {
+		return ErrNoHistory
+	}
+	frame := d.history[len(d.history)-1]
+	d.history = d.history[:len(d.history)-1]
+	d.alu.pc, d.alu.reg, d.in.next = frame.pc, frame.reg, frame.next
+	d.alu.stack = d.alu.stack[:frame.depth]
+	if frame.depth > 0 {
+		d.alu.stack[frame.depth-1] = frame.top
+	}
+	d.err = nil
+	return nil
+}
+
+// Continue executes instructions until the program ends, an instruction
+// fails, a watched register changes, or the next instruction is on a line
+// with a breakpoint. It always executes at least one instruction, so that
+// it can continue from a breakpoint. The error is only set for StopError.
+func (d *Debugger) Continue() (StopReason, error) {
+	for !d.Finished() {
+		before := d.alu.reg
+		if err := d.Step(); err != nil {
+			return StopError, err
+		}
+
+		for i, watched := range d.watches {
+			if watched && d.alu.reg[i] != before[i] {
+				return StopWatchpoint, nil
+			}
+		}
+
+		if line, ok := d.Line(); ok {
+			if _, ok := d.breaks[line]; ok {
+				return StopBreakpoint, nil
+			}
+		}
+	}
+	return StopEnd, nil
+}
+
+// SetBreakpoint makes Continue stop before the instruction on the given line.
+func (d *Debugger) SetBreakpoint(line int) error {
+	for _, inst := range d.alu.code {
+		if inst.line == line {
+			d.breaks[line] = struct{}{}
+			return nil
+		}
+	}
+	return errors.Errorf("there is no instruction on line %d", line)
+}
+
+// ClearBreakpoint removes the breakpoint from the given line, if it has one.
+func (d *Debugger) ClearBreakpoint(line int) {
+	delete(d.breaks, line)
+}
+
+// Breakpoints returns the line of every breakpoint, in order.
+func (d *Debugger) Breakpoints() []int {
+	lines := make([]int, 0, len(d.breaks))
+	for line := range d.breaks {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Watch makes Continue stop whenever the named register changes value.
+func (d *Debugger) Watch(register string) error {
+	r, err := parseR1(register)
+	if err != nil {
+		return errors.Wrapf(err, "cannot watch %q", register)
+	}
+	d.watches[r] = true
+	return nil
+}
+
+// Unwatch removes the watchpoint from the named register, if it has one.
+func (d *Debugger) Unwatch(register string) error {
+	r, err := parseR1(register)
+	if err != nil {
+		return errors.Wrapf(err, "cannot unwatch %q", register)
+	}
+	d.watches[r] = false
+	return nil
+}
+
+// Watches returns the name of every watched register.
+func (d *Debugger) Watches() []string {
+	var names []string
+	for r, watched := range d.watches {
+		if watched {
+			names = append(names, registerID(r).String())
+		}
+	}
+	return names
+}
+
+// Registers returns the current value of each register.
+func (d *Debugger) Registers() Registers {
+	return registers(d.alu.reg)
+}
+
+// Steps returns the number of steps taken since the start of the program.
+func (d *Debugger) Steps() int {
+	return len(d.history)
+}
+
+// Finished checks if the program has run to the end.
+func (d *Debugger) Finished() bool {
+	return d.alu.pc >= len(d.alu.code)
+}
+
+// Line returns the source line of the next instruction, and false if the
+// program has finished.
+func (d *Debugger) Line() (int, bool) {
+	if d.Finished() {
+		return 0, false
+	}
+	return d.alu.code[d.alu.pc].line, true
+}
+
+// Index returns the index in the program of the next instruction, and
+// false if the program has finished.
+func (d *Debugger) Index() (int, bool) {
+	if d.Finished() {
+		return 0, false
+	}
+	return d.alu.pc, true
+}
+
+// Current returns the source code of the next instruction, and false if the
+// program has finished.
+func (d *Debugger) Current() (string, bool) {
+	if d.Finished() {
+		return "", false
+	}
+	return d.alu.code[d.alu.pc].String(), true
+}
+
+// Err returns the error from the most recent step, if it failed.
+func (d *Debugger) Err() error {
+	return d.err
+}
+
+// Program returns the program being debugged.
+func (d *Debugger) Program() Program {
+	return d.alu.code
+}
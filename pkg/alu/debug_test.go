@@ -0,0 +1,153 @@
+package alu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const debugSource = `inp w
+add x w
+mul x 2
+
+inp y
+add z y
+div z x
+`
+
+func TestDebugger_stepAndStepBack(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(debugSource))
+	r.NoError(err)
+	d := NewDebugger(code, Ints(3, 12))
+
+	line, ok := d.Line()
+	a.True(ok)
+	a.Equal(1, line)
+	a.ErrorIs(d.StepBack(), ErrNoHistory)
+
+	for i := 0; i < 3; i++ {
+		r.NoError(d.Step())
+	}
+	a.Equal(Registers{W: 3, X: 6}, d.Registers())
+	src, _ := d.Current()
+	a.Equal("inp y", src)
+	i, ok := d.Index()
+	a.True(ok)
+	a.Equal(3, i)
+	a.Equal(5, d.Program().Line(i))
+
+	r.NoError(d.Step())
+	r.NoError(d.Step())
+	a.Equal(Registers{W: 3, X: 6, Y: 12, Z: 12}, d.Registers())
+
+	// stepping back over an inp rewinds the input, so that stepping
+	// forward again reads the same value:
+	r.NoError(d.StepBack())
+	r.NoError(d.StepBack())
+	a.Equal(Registers{W: 3, X: 6}, d.Registers())
+	a.Equal(3, d.Steps())
+
+	for i := 0; i < 3; i++ {
+		r.NoError(d.Step())
+	}
+	a.Equal(Registers{W: 3, X: 6, Y: 12, Z: 2}, d.Registers())
+	a.True(d.Finished())
+	a.ErrorIs(d.Step(), ErrFinished)
+}
+
+func TestDebugger_failedStep(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(debugSource))
+	r.NoError(err)
+	d := NewDebugger(code, Ints(0, 5))
+
+	reason, err := d.Continue()
+	a.Equal(StopError, reason)
+	a.EqualError(err, "execution failed on line 7: divide by 0")
+	a.Equal(err, d.Err())
+
+	// the failed instruction is still next, and the registers are unchanged:
+	line, _ := d.Line()
+	a.Equal(7, line)
+	a.Equal(Registers{Y: 5, Z: 5}, d.Registers())
+
+	r.NoError(d.StepBack())
+	a.NoError(d.Err())
+	line, _ = d.Line()
+	a.Equal(6, line)
+}
+
+func TestDebugger_Continue(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(debugSource))
+	r.NoError(err)
+	d := NewDebugger(code, Ints(1, 4))
+
+	a.Error(d.SetBreakpoint(4))
+	r.NoError(d.SetBreakpoint(5))
+	r.NoError(d.SetBreakpoint(7))
+	a.Equal([]int{5, 7}, d.Breakpoints())
+	r.NoError(d.Watch("z"))
+	a.Error(d.Watch("q"))
+	a.Equal([]string{"z"}, d.Watches())
+
+	tt := []struct {
+		wantReason StopReason
+		wantLine   int
+	}{
+		{StopBreakpoint, 5},
+		{StopWatchpoint, 7},
+		{StopWatchpoint, 0},
+		{StopEnd, 0},
+	}
+
+	for _, tc := range tt {
+		reason, err := d.Continue()
+		r.NoError(err)
+		a.Equal(tc.wantReason, reason)
+		line, _ := d.Line()
+		a.Equal(tc.wantLine, line)
+	}
+	a.Equal(Registers{W: 1, X: 2, Y: 4, Z: 2}, d.Registers())
+
+	d.ClearBreakpoint(5)
+	d.ClearBreakpoint(7)
+	r.NoError(d.Unwatch("z"))
+	a.Empty(d.Breakpoints())
+	a.Empty(d.Watches())
+}
+
+func TestDebugger_stepBackThroughCalls(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte("call f\ncall f\njmp end\nf: add z 1\nret\nend:\n"))
+	r.NoError(err)
+	d := NewDebugger(code, Ints())
+
+	var lines []int
+	for !d.Finished() {
+		line, _ := d.Line()
+		lines = append(lines, line)
+		r.NoError(d.Step())
+	}
+	a.Equal([]int{1, 4, 5, 2, 4, 5, 3}, lines)
+	a.Equal(Registers{Z: 2}, d.Registers())
+
+	// step back to just after the first ret, and go forwards again:
+	for i := 0; i < 4; i++ {
+		r.NoError(d.StepBack())
+	}
+	line, _ := d.Line()
+	a.Equal(2, line)
+	a.Equal(Registers{Z: 1}, d.Registers())
+
+	reason, err := d.Continue()
+	r.NoError(err)
+	a.Equal(StopEnd, reason)
+	a.Equal(Registers{Z: 2}, d.Registers())
+}
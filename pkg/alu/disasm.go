@@ -0,0 +1,153 @@
+package alu
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compile-time interface checks
+var (
+	_ encoding.TextMarshaler   = Program{}
+	_ encoding.TextUnmarshaler = (*Program)(nil)
+	_ fmt.Formatter            = Program{}
+)
+
+// MarshalText implements encoding.TextMarshaler. It disassembles the program
+// into canonical source code, with one instruction per line.
+//
+// Wherever it can, MarshalText pads the output with blank lines so that each
+// instruction appears on its original line number. That way, compiling the
+// output again gives a program with the same line numbers as this one, even
+// after an optimizer has removed some of the instructions.
+//
+// Labels are written on the same line as the instruction they name, and a
+// label for the end of the program is written on a line of its own.
+func (p Program) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	labels := p.labels()
+	line := 1
+	for i, inst := range p {
+		for ; line < inst.line; line++ {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(labels[i])
+		buf.WriteString(inst.String())
+		buf.WriteByte('\n')
+		line++
+	}
+	if end := labels[len(p)]; end != "" {
+		buf.WriteString(strings.TrimSuffix(end, " "))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// labels finds the name of every label used by a jump or call, and returns
+// the definitions for each instruction index, such as "loop: ". The index
+// len(p) holds the labels for the end of the program.
+func (p Program) labels() map[int]string {
+	names := make(map[int][]string)
+	seen := make(map[string]bool)
+	for _, inst := range p {
+		if inst.p2.kind != labelOperand || seen[inst.p2.label] {
+			continue
+		}
+		seen[inst.p2.label] = true
+		names[inst.p2.n] = append(names[inst.p2.n], inst.p2.label)
+	}
+
+	defs := make(map[int]string, len(names))
+	for i, list := range names {
+		sort.Strings(list)
+		defs[i] = strings.Join(list, ": ") + ": "
+	}
+	return defs
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, by compiling the text.
+func (p *Program) UnmarshalText(text []byte) error {
+	code, err := Compile(text)
+	if err != nil {
+		return err
+	}
+	*p = code
+	return nil
+}
+
+// Format implements fmt.Formatter.
+// The %v and %s verbs print the program's source code, one instruction per
+// line. Adding the '+' flag prefixes each instruction with its line number,
+// or its file and line for a program from CompileFS, and marks each
+// instruction from a macro with the place where the macro was used.
+func (p Program) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+	default:
+		fmt.Fprintf(s, "%%!%c(alu.Program)", verb)
+		return
+	}
+
+	width := 0
+	if s.Flag('+') {
+		for _, inst := range p {
+			if n := len(inst.position()); n > width {
+				width = n
+			}
+		}
+	}
+
+	labels := p.labels()
+	for i, inst := range p {
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%*s  ", width, inst.position())
+		}
+		fmt.Fprint(s, labels[i])
+		fmt.Fprint(s, inst)
+		if s.Flag('+') && inst.src != nil && inst.src.expansion != "" {
+			fmt.Fprintf(s, "  # from %s", inst.src.expansion)
+		}
+		fmt.Fprintln(s)
+	}
+	if end := labels[len(p)]; end != "" {
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%*s  ", width, "")
+		}
+		fmt.Fprintln(s, strings.TrimSuffix(end, " "))
+	}
+}
+
+// position returns the instruction's line number, as a string, along with
+// its file if it has one.
+func (inst instruction) position() string {
+	if file := inst.src.instFile(); file != "" {
+		return fmt.Sprintf("%s:%d", file, inst.line)
+	}
+	return strconv.Itoa(inst.line)
+}
+
+// where describes the instruction's position for an error message, such as
+// "line 12" or "main.alu:12".
+func (inst *instruction) where() string {
+	if inst.src.instFile() != "" {
+		return inst.position()
+	}
+	return fmt.Sprintf("line %d", inst.line)
+}
+
+// String implements fmt.Stringer, giving the instruction's canonical source.
+func (inst instruction) String() string {
+	switch {
+	case inst.op == opReturn:
+		return inst.op.String()
+	case !inst.op.hasR1():
+		return fmt.Sprintf("%s %s", inst.op, inst.p2)
+	case inst.p2.kind == noOperand:
+		return fmt.Sprintf("%s %s", inst.op, inst.r1)
+	default:
+		return fmt.Sprintf("%s %s %s", inst.op, inst.r1, inst.p2)
+	}
+}
@@ -0,0 +1,95 @@
+package alu
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgram_MarshalText(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "canonical source is unchanged",
+			in:   "inp w\nadd x w\nmul y -3\n",
+			want: "inp w\nadd x w\nmul y -3\n",
+		},
+		{
+			name: "whitespace and comments are normalised, but line numbers kept",
+			in:   "# header\n\ninp\tw  # read\r\n\n  eql x   +7\n",
+			want: "\n\ninp w\n\neql x 7\n",
+		},
+		{
+			name: "empty program",
+			in:   "# nothing here\n",
+			want: "",
+		},
+		{
+			name: "labels move onto the line of their instruction",
+			in:   "top:\n  add x 1\n  jnz y top\nsub: ret\n\ncall sub\njmp done\nunused: inp w\ndone:\n",
+			want: "\ntop: add x 1\njnz y top\nsub: ret\n\ncall sub\njmp done\ninp w\ndone:\n",
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, a := require.New(t), assert.New(t)
+
+			code, err := Compile([]byte(tc.in))
+			r.NoError(err)
+
+			got, err := code.MarshalText()
+			r.NoError(err)
+			a.Equal(tc.want, string(got))
+		})
+	}
+}
+
+func TestProgram_roundTrip(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+
+	var first Program
+	r.NoError(first.UnmarshalText(src))
+
+	text, err := first.MarshalText()
+	r.NoError(err)
+	a.Equal(string(src), string(text))
+
+	var second Program
+	r.NoError(second.UnmarshalText(text))
+	r.Equal(len(first), len(second))
+	for i := range first {
+		a.Equal(first[i].line, second[i].line)
+		a.Equal(first[i].String(), second[i].String())
+	}
+}
+
+func TestProgram_UnmarshalText_error(t *testing.T) {
+	var p Program
+	err := p.UnmarshalText([]byte("add q 1\n"))
+	require.Error(t, err)
+	assert.Nil(t, p)
+}
+
+func TestProgram_Format(t *testing.T) {
+	a := assert.New(t)
+
+	code, err := Compile([]byte("inp w\n\n# skip\nadd z w\n\n\n\n\n\n\nmod z 2\n"))
+	require.NoError(t, err)
+
+	a.Equal("inp w\nadd z w\nmod z 2\n", fmt.Sprintf("%v", code))
+	a.Equal("inp w\nadd z w\nmod z 2\n", fmt.Sprint(code))
+	a.Equal(" 1  inp w\n 4  add z w\n11  mod z 2\n", fmt.Sprintf("%+v", code))
+	a.Equal("%!d(alu.Program)", fmt.Sprintf("%d", code))
+}
@@ -0,0 +1,328 @@
+package alu
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// EquivalenceOptions control how CheckEquivalent searches for an input that
+// makes two implementations disagree.
+type EquivalenceOptions struct {
+	// Length is the number of input values for each run.
+	Length int
+
+	// Alphabet holds every value that an input can take.
+	Alphabet []int
+
+	// ExhaustiveLimit is the largest number of possible inputs that will be
+	// checked one by one. If there are more, inputs are sampled instead.
+	// The default is 1 << 16.
+	ExhaustiveLimit int
+
+	// Samples is the number of inputs to check when sampling. The default
+	// is 10000.
+	Samples int
+
+	// Seed seeds the random sampling, so that results can be repeated.
+	Seed int64
+}
+
+// EquivalenceResult is the outcome of CheckEquivalent.
+type EquivalenceResult struct {
+	// Proven is true if the two programs were shown to agree on every
+	// input without running them, by comparing them symbolically.
+	Proven bool
+
+	// Exhaustive is true if every possible input was checked.
+	Exhaustive bool
+
+	// Checked is the number of inputs that were run.
+	Checked int
+
+	// Counterexample is an input where the two disagree, or nil if none
+	// was found.
+	Counterexample *Counterexample
+}
+
+// Counterexample is an input where two implementations disagree.
+type Counterexample struct {
+	Inputs []int
+
+	Z, OtherZ     int   // Z and OtherZ are the results of each implementation.
+	Err, OtherErr error // Err and OtherErr are their errors, if any.
+}
+
+// String implements fmt.Stringer.
+func (c *Counterexample) String() string {
+	describe := func(z int, err error) string {
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("z = %d", z)
+	}
+	return fmt.Sprintf("input %v: %s, but the other gives %s",
+		c.Inputs, describe(c.Z, c.Err), describe(c.OtherZ, c.OtherErr))
+}
+
+// evaluator runs one implementation with the given inputs.
+type evaluator func(inputs []int) (int, error)
+
+func programEvaluator(code Program) evaluator {
+	calc := New(code)
+	return func(inputs []int) (int, error) {
+		return calc.Run(Ints(inputs...))
+	}
+}
+
+// CheckEquivalent looks for an input where a program and another
+// implementation of it return different values of z. The other
+// implementation is either a Program, or a Go function of type
+// func([]int) int. Two programs agree on an input if they both fail, or if
+// neither fails and they return the same z; a program that fails never
+// agrees with a Go function.
+//
+// Two programs without control flow are first compared symbolically, which
+// can prove them equivalent without running them. Otherwise, if there are
+// few enough possible inputs, every one is checked, in order. If there are
+// too many, the check samples inputs: first each input that repeats a
+// single value, then random inputs, and then variations of those with one
+// or two values changed.
+//
+// A counterexample is made minimal before it is returned: no single input
+// value can be replaced by an earlier value in the alphabet with the two
+// implementations still disagreeing.
+func CheckEquivalent(code Program, other interface{}, opts EquivalenceOptions) (EquivalenceResult, error) {
+	if len(opts.Alphabet) == 0 {
+		return EquivalenceResult{}, errors.New("the alphabet is empty")
+	}
+	if opts.Length < 0 {
+		return EquivalenceResult{}, errors.Errorf("invalid input length %d", opts.Length)
+	}
+	if opts.ExhaustiveLimit == 0 {
+		opts.ExhaustiveLimit = 1 << 16
+	}
+	if opts.Samples == 0 {
+		opts.Samples = 10000
+	}
+	alphabet := append([]int(nil), opts.Alphabet...)
+	sort.Ints(alphabet)
+
+	var otherEval evaluator
+	switch other := other.(type) {
+	case Program:
+		if proveEquivalent(code, other, alphabet, opts.Length) {
+			return EquivalenceResult{Proven: true}, nil
+		}
+		otherEval = programEvaluator(other)
+	case func([]int) int:
+		otherEval = func(inputs []int) (int, error) {
+			return other(inputs), nil
+		}
+	default:
+		return EquivalenceResult{}, errors.Errorf("cannot compare a program with a %T", other)
+	}
+
+	c := equivChecker{
+		alphabet: alphabet,
+		eval:     programEvaluator(code),
+		other:    otherEval,
+	}
+
+	var found []int
+	if total, ok := countInputs(len(alphabet), opts.Length); ok && total <= opts.ExhaustiveLimit {
+		c.res.Exhaustive = true
+		found = c.exhaustive(opts.Length)
+	} else {
+		found = c.sample(opts.Length, opts.Samples, rand.New(rand.NewSource(opts.Seed)))
+	}
+
+	if found != nil {
+		c.res.Counterexample = c.shrink(found)
+	}
+	return c.res, nil
+}
+
+// proveEquivalent checks if two programs always return the same z, given
+// inputs with values in the alphabet. It returns false if it cannot tell.
+func proveEquivalent(a, b Program, alphabet []int, length int) bool {
+	if straightLine(a) != nil || straightLine(b) != nil {
+		return false
+	}
+
+	// the symbolic runs assume that neither program fails, so first check
+	// that neither can divide by 0. Nor can a proof be trusted if any
+	// value might overflow and wrap around:
+	for _, code := range []Program{a, b} {
+		report, err := AnalyzeRanges(code, alphabet)
+		if err != nil || len(report.Unsafe()) > 0 || mayOverflow(report) {
+			return false
+		}
+	}
+
+	lo, hi := alphabet[0], alphabet[len(alphabet)-1]
+	builder := newExprBuilder()
+	symA, err := runSymbolic(builder, a, lo, hi)
+	if err != nil || symA.Inputs != length {
+		return false
+	}
+	symB, err := runSymbolic(builder, b, lo, hi)
+	if err != nil || symB.Inputs != length {
+		return false
+	}
+
+	// both results come from the same builder, so identical expressions
+	// are the same node:
+	return symA.Z == symB.Z
+}
+
+// mayOverflow returns true if any register might overflow, according to
+// the report; range analysis saturates its bounds whenever it might.
+func mayOverflow(report *RangeReport) bool {
+	saturated := func(i Interval) bool {
+		return i.Lo == math.MinInt || i.Hi == math.MaxInt
+	}
+	for i, after := range report.After {
+		if !report.Reachable[i] {
+			continue
+		}
+		if saturated(after.W) || saturated(after.X) || saturated(after.Y) || saturated(after.Z) {
+			return true
+		}
+	}
+	return false
+}
+
+// countInputs returns the number of different inputs of the given length,
+// and false if the number is too large for an int.
+func countInputs(size, length int) (int, bool) {
+	total := 1
+	for i := 0; i < length; i++ {
+		next, ok := mulExact(total, size)
+		if !ok {
+			return 0, false
+		}
+		total = next
+	}
+	return total, true
+}
+
+// equivChecker runs the two implementations on each input that it is given.
+type equivChecker struct {
+	alphabet    []int
+	eval, other evaluator
+	res         EquivalenceResult
+}
+
+// differ runs both implementations, and checks if they disagree.
+func (c *equivChecker) differ(inputs []int) bool {
+	c.res.Checked++
+	return c.compare(inputs) != nil
+}
+
+// compare runs both implementations, and returns a counterexample if they
+// disagree.
+func (c *equivChecker) compare(inputs []int) *Counterexample {
+	z, err := c.eval(inputs)
+	otherZ, otherErr := c.other(inputs)
+	if (err != nil) == (otherErr != nil) && (err != nil || z == otherZ) {
+		return nil
+	}
+	return &Counterexample{
+		Inputs: append([]int(nil), inputs...),
+		Z:      z, OtherZ: otherZ,
+		Err: err, OtherErr: otherErr,
+	}
+}
+
+// exhaustive checks every input of the given length, in order, and returns
+// the first one where the implementations disagree.
+func (c *equivChecker) exhaustive(length int) []int {
+	index := make([]int, length)
+	inputs := make([]int, length)
+	for {
+		for i, j := range index {
+			inputs[i] = c.alphabet[j]
+		}
+		if c.differ(inputs) {
+			return inputs
+		}
+
+		// move on to the next input, like an odometer:
+		i := length - 1
+		for ; i >= 0; i-- {
+			index[i]++
+			if index[i] < len(c.alphabet) {
+				break
+			}
+			index[i] = 0
+		}
+		if i < 0 {
+			return nil
+		}
+	}
+}
+
+// sample checks up to n inputs of the given length, and returns the first
+// one where the implementations disagree.
+func (c *equivChecker) sample(length, n int, rng *rand.Rand) []int {
+	inputs := make([]int, length)
+
+	// inputs that repeat a single value are often edge cases:
+	for _, v := range c.alphabet {
+		if c.res.Checked == n {
+			return nil
+		}
+		for i := range inputs {
+			inputs[i] = v
+		}
+		if c.differ(inputs) {
+			return inputs
+		}
+	}
+
+	// then random inputs, and random changes to those:
+	var seeds [][]int
+	for c.res.Checked < n {
+		if len(seeds) == 0 || length == 0 || rng.Intn(2) == 0 {
+			for i := range inputs {
+				inputs[i] = c.alphabet[rng.Intn(len(c.alphabet))]
+			}
+			seeds = append(seeds, append([]int(nil), inputs...))
+		} else {
+			copy(inputs, seeds[rng.Intn(len(seeds))])
+			for k := 1 + rng.Intn(2); k > 0; k-- {
+				inputs[rng.Intn(length)] = c.alphabet[rng.Intn(len(c.alphabet))]
+			}
+		}
+		if c.differ(inputs) {
+			return inputs
+		}
+	}
+	return nil
+}
+
+// shrink makes a counterexample minimal, by replacing each input value with
+// the earliest value in the alphabet that still gives a counterexample.
+func (c *equivChecker) shrink(inputs []int) *Counterexample {
+	for changed := true; changed; {
+		changed = false
+		for i, v := range inputs {
+			for _, smaller := range c.alphabet {
+				if smaller >= v {
+					break
+				}
+				inputs[i] = smaller
+				if c.compare(inputs) != nil {
+					changed = true
+					break
+				}
+				inputs[i] = v
+			}
+		}
+	}
+	return c.compare(inputs)
+}
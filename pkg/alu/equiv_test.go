@@ -0,0 +1,149 @@
+package alu
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckEquivalent(t *testing.T) {
+	digits := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	tt := []struct {
+		name           string
+		program        string
+		other          interface{} // other is source code, or a Go function.
+		opts           EquivalenceOptions
+		wantProven     bool
+		wantExhaustive bool
+		wantInputs     []int // wantInputs is the counterexample, if any.
+	}{
+		{
+			name:       "programs with the same meaning are proven equivalent",
+			program:    "inp w\nadd z w\nmul z 3\n",
+			other:      "inp x\nmul x 3\nadd z x\n",
+			opts:       EquivalenceOptions{Length: 1, Alphabet: digits},
+			wantProven: true,
+		},
+		{
+			name:           "programs that might overflow are not proven",
+			program:        "inp w\nmul w 4611686018427387904\ndiv w 4611686018427387904\nadd z w\n",
+			other:          "inp w\nadd z w\n",
+			opts:           EquivalenceOptions{Length: 1, Alphabet: []int{1, 2, 3}},
+			wantExhaustive: true,
+			wantInputs:     []int{2},
+		},
+		{
+			name:           "programs that cannot be proven are checked exhaustively",
+			program:        "inp w\ninp x\nmul w x\nadd z w\n",
+			other:          "inp w\ninp x\nmul x w\nadd z x\n",
+			opts:           EquivalenceOptions{Length: 2, Alphabet: digits},
+			wantExhaustive: true,
+		},
+		{
+			name:           "a minimal counterexample",
+			program:        "inp w\ninp x\nadd z w\nadd z x\neql w 7\nmul w x\nadd z w\n",
+			other:          "inp w\ninp x\nadd z w\nadd z x\n",
+			opts:           EquivalenceOptions{Length: 2, Alphabet: digits},
+			wantExhaustive: true,
+			wantInputs:     []int{7, 1},
+		},
+		{
+			name:           "both programs failing counts as agreement",
+			program:        "inp w\ninp x\nmod w x\nadd z w\n",
+			other:          "inp y\ninp x\nmod y x\nadd z y\n",
+			opts:           EquivalenceOptions{Length: 2, Alphabet: []int{0, 1, 2}},
+			wantExhaustive: true,
+		},
+		{
+			name:    "a Go function",
+			program: "inp w\ninp x\nmul w 10\nadd w x\nadd z w\n",
+			other: func(in []int) int {
+				return in[0]*10 + in[1]
+			},
+			opts:           EquivalenceOptions{Length: 2, Alphabet: digits},
+			wantExhaustive: true,
+		},
+		{
+			name:    "a program that fails never agrees with a Go function",
+			program: "inp w\ninp x\ndiv w x\nadd z w\n",
+			other: func(in []int) int {
+				if in[1] == 0 {
+					return 0
+				}
+				return in[0] / in[1]
+			},
+			opts:           EquivalenceOptions{Length: 2, Alphabet: []int{3, 0, 2}},
+			wantExhaustive: true,
+			wantInputs:     []int{0, 0},
+		},
+		{
+			name:    "sampling finds a rare difference and shrinks it",
+			program: "inp w\ninp x\ninp y\ninp z\n",
+			other: func(in []int) int {
+				if in[0] == 9 && in[2] > 7 {
+					return 0
+				}
+				return in[3]
+			},
+			opts:       EquivalenceOptions{Length: 4, Alphabet: digits, ExhaustiveLimit: 100},
+			wantInputs: []int{9, 1, 8, 1},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, a := require.New(t), assert.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			other := tc.other
+			if src, ok := other.(string); ok {
+				other, err = Compile([]byte(src))
+				r.NoError(err)
+			}
+
+			got, err := CheckEquivalent(code, other, tc.opts)
+			r.NoError(err)
+			a.Equal(tc.wantProven, got.Proven)
+			a.Equal(tc.wantExhaustive, got.Exhaustive)
+
+			if tc.wantInputs == nil {
+				a.Nil(got.Counterexample)
+				return
+			}
+			r.NotNil(got.Counterexample)
+			a.Equal(tc.wantInputs, got.Counterexample.Inputs, got.Counterexample.String())
+		})
+	}
+}
+
+func TestCheckEquivalent_optimizedDay24(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+	code, err := Compile(src)
+	r.NoError(err)
+
+	got, err := CheckEquivalent(code, Optimize(code, AllPasses), EquivalenceOptions{
+		Length:   14,
+		Alphabet: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+	})
+	r.NoError(err)
+	r.True(got.Proven)
+	r.Nil(got.Counterexample)
+}
+
+func TestCheckEquivalent_errors(t *testing.T) {
+	_, err := CheckEquivalent(nil, Program(nil), EquivalenceOptions{})
+	assert.EqualError(t, err, "the alphabet is empty")
+
+	_, err = CheckEquivalent(nil, "add z 1", EquivalenceOptions{Alphabet: []int{0}})
+	assert.EqualError(t, err, "cannot compare a program with a string")
+}
@@ -0,0 +1,70 @@
+package alu
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SyntaxError describes a single problem found while compiling ALU source.
+type SyntaxError struct {
+	File string // File is the name of the file, or "" for the source given to Compile.
+	Line int    // Line is the line number, starting at 1.
+	Col  int    // Col is the byte offset within the line, starting at 1.
+	Msg  string // Msg describes the problem.
+}
+
+// Error implements error.
+func (e *SyntaxError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s: line %d, col %d: %s", e.File, e.Line, e.Col, e.Msg)
+	}
+	return fmt.Sprintf("line %d, col %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// ErrorList is a list of syntax errors. Compile returns an ErrorList
+// holding every problem it found, sorted by position.
+type ErrorList []*SyntaxError
+
+// Error implements error.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+	}
+}
+
+// Err returns nil if the list is empty, and the list itself otherwise.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// add appends a new error at the given token to the list.
+func (l *ErrorList) add(at token, format string, args ...interface{}) {
+	e := &SyntaxError{Line: at.line, Col: at.col, Msg: fmt.Sprintf(format, args...)}
+	if at.src != nil {
+		e.File = at.src.file
+	}
+	*l = append(*l, e)
+}
+
+// sort the list by position, keeping errors at the same position in the
+// order they were added. Order gives the place of each file, in the order
+// that they were first included.
+func (l ErrorList) sort(order map[string]int) {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].File != l[j].File {
+			return order[l[i].File] < order[l[j].File]
+		}
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].Col < l[j].Col
+	})
+}
@@ -0,0 +1,726 @@
+// Code generated by gen_exec.go; DO NOT EDIT.
+
+package alu
+
+// executeFast runs instructions from index i, starting with the current
+// state of the registers. It behaves exactly like calling step for each
+// instruction, but is much faster. It stops at index end, which must not
+// be part way through a fused instruction (see fuse), or at the first
+// control flow instruction, which it leaves for step.
+//
+// It returns the index where it stopped, which is the index of the failed
+// instruction if there is an error.
+//
+// The inner loop makes no function calls, which lets the compiler keep the
+// registers in machine registers. Reading input needs a call, so inp
+// instructions jump out to the outer loop.
+func (a *ALU) executeFast(code Program, i, end int) (int, error) {
+	w, x, y, z := a.reg[0], a.reg[1], a.reg[2], a.reg[3]
+	for {
+		for ; i < end; i++ {
+			inst := &code[i]
+			n := inst.p2.n
+			switch inst.exec {
+			case 4: // inp w
+				goto input
+			case 9: // inp x
+				goto input
+			case 14: // inp y
+				goto input
+			case 19: // inp z
+				goto input
+			case 20: // add w w
+				w += w
+			case 21: // add w x
+				w += x
+			case 22: // add w y
+				w += y
+			case 23: // add w z
+				w += z
+			case 24: // add w n
+				w += n
+			case 25: // add x w
+				x += w
+			case 26: // add x x
+				x += x
+			case 27: // add x y
+				x += y
+			case 28: // add x z
+				x += z
+			case 29: // add x n
+				x += n
+			case 30: // add y w
+				y += w
+			case 31: // add y x
+				y += x
+			case 32: // add y y
+				y += y
+			case 33: // add y z
+				y += z
+			case 34: // add y n
+				y += n
+			case 35: // add z w
+				z += w
+			case 36: // add z x
+				z += x
+			case 37: // add z y
+				z += y
+			case 38: // add z z
+				z += z
+			case 39: // add z n
+				z += n
+			case 40: // mul w w
+				w *= w
+			case 41: // mul w x
+				w *= x
+			case 42: // mul w y
+				w *= y
+			case 43: // mul w z
+				w *= z
+			case 44: // mul w n
+				w *= n
+			case 45: // mul x w
+				x *= w
+			case 46: // mul x x
+				x *= x
+			case 47: // mul x y
+				x *= y
+			case 48: // mul x z
+				x *= z
+			case 49: // mul x n
+				x *= n
+			case 50: // mul y w
+				y *= w
+			case 51: // mul y x
+				y *= x
+			case 52: // mul y y
+				y *= y
+			case 53: // mul y z
+				y *= z
+			case 54: // mul y n
+				y *= n
+			case 55: // mul z w
+				z *= w
+			case 56: // mul z x
+				z *= x
+			case 57: // mul z y
+				z *= y
+			case 58: // mul z z
+				z *= z
+			case 59: // mul z n
+				z *= n
+			case 60: // div w w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				w /= w
+			case 61: // div w x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				w /= x
+			case 62: // div w y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				w /= y
+			case 63: // div w z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				w /= z
+			case 64: // div w n
+				w /= n
+			case 65: // div x w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				x /= w
+			case 66: // div x x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				x /= x
+			case 67: // div x y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				x /= y
+			case 68: // div x z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				x /= z
+			case 69: // div x n
+				x /= n
+			case 70: // div y w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				y /= w
+			case 71: // div y x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				y /= x
+			case 72: // div y y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				y /= y
+			case 73: // div y z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				y /= z
+			case 74: // div y n
+				y /= n
+			case 75: // div z w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				z /= w
+			case 76: // div z x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				z /= x
+			case 77: // div z y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				z /= y
+			case 78: // div z z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errDivide(inst)
+				}
+				z /= z
+			case 79: // div z n
+				z /= n
+			case 80: // mod w w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				w %= w
+			case 81: // mod w x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				w %= x
+			case 82: // mod w y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				w %= y
+			case 83: // mod w z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				w %= z
+			case 84: // mod w n
+				w %= n
+			case 85: // mod x w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				x %= w
+			case 86: // mod x x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				x %= x
+			case 87: // mod x y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				x %= y
+			case 88: // mod x z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				x %= z
+			case 89: // mod x n
+				x %= n
+			case 90: // mod y w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				y %= w
+			case 91: // mod y x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				y %= x
+			case 92: // mod y y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				y %= y
+			case 93: // mod y z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				y %= z
+			case 94: // mod y n
+				y %= n
+			case 95: // mod z w
+				if w == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				z %= w
+			case 96: // mod z x
+				if x == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				z %= x
+			case 97: // mod z y
+				if y == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				z %= y
+			case 98: // mod z z
+				if z == 0 {
+					a.reg = [4]int{w, x, y, z}
+					return i, errModulo(inst)
+				}
+				z %= z
+			case 99: // mod z n
+				z %= n
+			case 100: // eql w w
+				if w == w {
+					w = 1
+				} else {
+					w = 0
+				}
+			case 101: // eql w x
+				if w == x {
+					w = 1
+				} else {
+					w = 0
+				}
+			case 102: // eql w y
+				if w == y {
+					w = 1
+				} else {
+					w = 0
+				}
+			case 103: // eql w z
+				if w == z {
+					w = 1
+				} else {
+					w = 0
+				}
+			case 104: // eql w n
+				if w == n {
+					w = 1
+				} else {
+					w = 0
+				}
+			case 105: // eql x w
+				if x == w {
+					x = 1
+				} else {
+					x = 0
+				}
+			case 106: // eql x x
+				if x == x {
+					x = 1
+				} else {
+					x = 0
+				}
+			case 107: // eql x y
+				if x == y {
+					x = 1
+				} else {
+					x = 0
+				}
+			case 108: // eql x z
+				if x == z {
+					x = 1
+				} else {
+					x = 0
+				}
+			case 109: // eql x n
+				if x == n {
+					x = 1
+				} else {
+					x = 0
+				}
+			case 110: // eql y w
+				if y == w {
+					y = 1
+				} else {
+					y = 0
+				}
+			case 111: // eql y x
+				if y == x {
+					y = 1
+				} else {
+					y = 0
+				}
+			case 112: // eql y y
+				if y == y {
+					y = 1
+				} else {
+					y = 0
+				}
+			case 113: // eql y z
+				if y == z {
+					y = 1
+				} else {
+					y = 0
+				}
+			case 114: // eql y n
+				if y == n {
+					y = 1
+				} else {
+					y = 0
+				}
+			case 115: // eql z w
+				if z == w {
+					z = 1
+				} else {
+					z = 0
+				}
+			case 116: // eql z x
+				if z == x {
+					z = 1
+				} else {
+					z = 0
+				}
+			case 117: // eql z y
+				if z == y {
+					z = 1
+				} else {
+					z = 0
+				}
+			case 118: // eql z z
+				if z == z {
+					z = 1
+				} else {
+					z = 0
+				}
+			case 119: // eql z n
+				if z == n {
+					z = 1
+				} else {
+					z = 0
+				}
+			case execSet + 1: // mul w 0 ; add w x
+				w = x
+				i++
+			case execSetAdd + 1: // mul w 0 ; add w x ; add w n
+				w = x + code[i+2].p2.n
+				i += 2
+			case execNeq + 1: // eql w x ; eql w 0
+				if w != x {
+					w = 1
+				} else {
+					w = 0
+				}
+				i++
+			case execMulAdd + 1: // mul w x ; add w n
+				w = w*x + code[i+1].p2.n
+				i++
+			case execSet + 2: // mul w 0 ; add w y
+				w = y
+				i++
+			case execSetAdd + 2: // mul w 0 ; add w y ; add w n
+				w = y + code[i+2].p2.n
+				i += 2
+			case execNeq + 2: // eql w y ; eql w 0
+				if w != y {
+					w = 1
+				} else {
+					w = 0
+				}
+				i++
+			case execMulAdd + 2: // mul w y ; add w n
+				w = w*y + code[i+1].p2.n
+				i++
+			case execSet + 3: // mul w 0 ; add w z
+				w = z
+				i++
+			case execSetAdd + 3: // mul w 0 ; add w z ; add w n
+				w = z + code[i+2].p2.n
+				i += 2
+			case execNeq + 3: // eql w z ; eql w 0
+				if w != z {
+					w = 1
+				} else {
+					w = 0
+				}
+				i++
+			case execMulAdd + 3: // mul w z ; add w n
+				w = w*z + code[i+1].p2.n
+				i++
+			case execSet + 4: // mul w 0 ; add w n
+				n = code[i+1].p2.n
+				w = n
+				i++
+			case execSetAdd + 4: // mul w 0 ; add w n ; add w n
+				n = code[i+1].p2.n
+				w = n + code[i+2].p2.n
+				i += 2
+			case execNeq + 4: // eql w n ; eql w 0
+				if w != n {
+					w = 1
+				} else {
+					w = 0
+				}
+				i++
+			case execMulAdd + 4: // mul w n ; add w n
+				w = w*n + code[i+1].p2.n
+				i++
+			case execSet + 5: // mul x 0 ; add x w
+				x = w
+				i++
+			case execSetAdd + 5: // mul x 0 ; add x w ; add x n
+				x = w + code[i+2].p2.n
+				i += 2
+			case execNeq + 5: // eql x w ; eql x 0
+				if x != w {
+					x = 1
+				} else {
+					x = 0
+				}
+				i++
+			case execMulAdd + 5: // mul x w ; add x n
+				x = x*w + code[i+1].p2.n
+				i++
+			case execSet + 7: // mul x 0 ; add x y
+				x = y
+				i++
+			case execSetAdd + 7: // mul x 0 ; add x y ; add x n
+				x = y + code[i+2].p2.n
+				i += 2
+			case execNeq + 7: // eql x y ; eql x 0
+				if x != y {
+					x = 1
+				} else {
+					x = 0
+				}
+				i++
+			case execMulAdd + 7: // mul x y ; add x n
+				x = x*y + code[i+1].p2.n
+				i++
+			case execSet + 8: // mul x 0 ; add x z
+				x = z
+				i++
+			case execSetAdd + 8: // mul x 0 ; add x z ; add x n
+				x = z + code[i+2].p2.n
+				i += 2
+			case execNeq + 8: // eql x z ; eql x 0
+				if x != z {
+					x = 1
+				} else {
+					x = 0
+				}
+				i++
+			case execMulAdd + 8: // mul x z ; add x n
+				x = x*z + code[i+1].p2.n
+				i++
+			case execSet + 9: // mul x 0 ; add x n
+				n = code[i+1].p2.n
+				x = n
+				i++
+			case execSetAdd + 9: // mul x 0 ; add x n ; add x n
+				n = code[i+1].p2.n
+				x = n + code[i+2].p2.n
+				i += 2
+			case execNeq + 9: // eql x n ; eql x 0
+				if x != n {
+					x = 1
+				} else {
+					x = 0
+				}
+				i++
+			case execMulAdd + 9: // mul x n ; add x n
+				x = x*n + code[i+1].p2.n
+				i++
+			case execSet + 10: // mul y 0 ; add y w
+				y = w
+				i++
+			case execSetAdd + 10: // mul y 0 ; add y w ; add y n
+				y = w + code[i+2].p2.n
+				i += 2
+			case execNeq + 10: // eql y w ; eql y 0
+				if y != w {
+					y = 1
+				} else {
+					y = 0
+				}
+				i++
+			case execMulAdd + 10: // mul y w ; add y n
+				y = y*w + code[i+1].p2.n
+				i++
+			case execSet + 11: // mul y 0 ; add y x
+				y = x
+				i++
+			case execSetAdd + 11: // mul y 0 ; add y x ; add y n
+				y = x + code[i+2].p2.n
+				i += 2
+			case execNeq + 11: // eql y x ; eql y 0
+				if y != x {
+					y = 1
+				} else {
+					y = 0
+				}
+				i++
+			case execMulAdd + 11: // mul y x ; add y n
+				y = y*x + code[i+1].p2.n
+				i++
+			case execSet + 13: // mul y 0 ; add y z
+				y = z
+				i++
+			case execSetAdd + 13: // mul y 0 ; add y z ; add y n
+				y = z + code[i+2].p2.n
+				i += 2
+			case execNeq + 13: // eql y z ; eql y 0
+				if y != z {
+					y = 1
+				} else {
+					y = 0
+				}
+				i++
+			case execMulAdd + 13: // mul y z ; add y n
+				y = y*z + code[i+1].p2.n
+				i++
+			case execSet + 14: // mul y 0 ; add y n
+				n = code[i+1].p2.n
+				y = n
+				i++
+			case execSetAdd + 14: // mul y 0 ; add y n ; add y n
+				n = code[i+1].p2.n
+				y = n + code[i+2].p2.n
+				i += 2
+			case execNeq + 14: // eql y n ; eql y 0
+				if y != n {
+					y = 1
+				} else {
+					y = 0
+				}
+				i++
+			case execMulAdd + 14: // mul y n ; add y n
+				y = y*n + code[i+1].p2.n
+				i++
+			case execSet + 15: // mul z 0 ; add z w
+				z = w
+				i++
+			case execSetAdd + 15: // mul z 0 ; add z w ; add z n
+				z = w + code[i+2].p2.n
+				i += 2
+			case execNeq + 15: // eql z w ; eql z 0
+				if z != w {
+					z = 1
+				} else {
+					z = 0
+				}
+				i++
+			case execMulAdd + 15: // mul z w ; add z n
+				z = z*w + code[i+1].p2.n
+				i++
+			case execSet + 16: // mul z 0 ; add z x
+				z = x
+				i++
+			case execSetAdd + 16: // mul z 0 ; add z x ; add z n
+				z = x + code[i+2].p2.n
+				i += 2
+			case execNeq + 16: // eql z x ; eql z 0
+				if z != x {
+					z = 1
+				} else {
+					z = 0
+				}
+				i++
+			case execMulAdd + 16: // mul z x ; add z n
+				z = z*x + code[i+1].p2.n
+				i++
+			case execSet + 17: // mul z 0 ; add z y
+				z = y
+				i++
+			case execSetAdd + 17: // mul z 0 ; add z y ; add z n
+				z = y + code[i+2].p2.n
+				i += 2
+			case execNeq + 17: // eql z y ; eql z 0
+				if z != y {
+					z = 1
+				} else {
+					z = 0
+				}
+				i++
+			case execMulAdd + 17: // mul z y ; add z n
+				z = z*y + code[i+1].p2.n
+				i++
+			case execSet + 19: // mul z 0 ; add z n
+				n = code[i+1].p2.n
+				z = n
+				i++
+			case execSetAdd + 19: // mul z 0 ; add z n ; add z n
+				n = code[i+1].p2.n
+				z = n + code[i+2].p2.n
+				i += 2
+			case execNeq + 19: // eql z n ; eql z 0
+				if z != n {
+					z = 1
+				} else {
+					z = 0
+				}
+				i++
+			case execMulAdd + 19: // mul z n ; add z n
+				z = z*n + code[i+1].p2.n
+				i++
+			case execControl:
+				a.reg = [4]int{w, x, y, z}
+				return i, nil
+			}
+		}
+		break
+
+	input:
+		// the registers are saved and reloaded around the call, so
+		// that they are never live across it
+		a.reg = [4]int{w, x, y, z}
+		n, err := a.read(&code[i])
+		if err != nil {
+			return i, err
+		}
+		a.reg[code[i].r1&3] = n
+		w, x, y, z = a.reg[0], a.reg[1], a.reg[2], a.reg[3]
+		i++
+	}
+
+	a.reg = [4]int{w, x, y, z}
+	return i, nil
+}
@@ -0,0 +1,164 @@
+//go:build ignore
+
+// gen_exec generates exec_gen.go, which holds the ALU's fast interpreter.
+//
+// The fast interpreter keeps each register in a local variable, and has one
+// case for every combination of opcode, first register and operand, so that
+// each instruction is a single jump followed by one arithmetic operation.
+// Writing all of those cases by hand would be tedious and error-prone.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+)
+
+var (
+	opcodes   = []string{"inp", "add", "mul", "div", "mod", "eql"}
+	registers = []string{"w", "x", "y", "z"}
+)
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by gen_exec.go; DO NOT EDIT.
+
+package alu
+
+// executeFast runs instructions from index i, starting with the current
+// state of the registers. It behaves exactly like calling step for each
+// instruction, but is much faster. It stops at index end, which must not
+// be part way through a fused instruction (see fuse), or at the first
+// control flow instruction, which it leaves for step.
+//
+// It returns the index where it stopped, which is the index of the failed
+// instruction if there is an error.
+//
+// The inner loop makes no function calls, which lets the compiler keep the
+// registers in machine registers. Reading input needs a call, so inp
+// instructions jump out to the outer loop.
+func (a *ALU) executeFast(code Program, i, end int) (int, error) {
+	w, x, y, z := a.reg[0], a.reg[1], a.reg[2], a.reg[3]
+	for {
+		for ; i < end; i++ {
+			inst := &code[i]
+			n := inst.p2.n
+			switch inst.exec {
+`)
+
+	for op, name := range opcodes {
+		for r1, r := range registers {
+			for src := 0; src < 5; src++ {
+				if name == "inp" && src != 4 {
+					continue
+				}
+				code := op*20 + r1*5 + src
+				s := "n"
+				comment := fmt.Sprintf("%s %s", name, r)
+				if src < 4 {
+					s = registers[src]
+					comment += " " + s
+				} else if name != "inp" {
+					comment += " n"
+				}
+				fmt.Fprintf(&buf, "case %d: // %s\n", code, comment)
+				buf.WriteString(body(name, r, s, src < 4))
+			}
+		}
+	}
+
+	// Fused instructions take their operands from whichever instruction has
+	// them, and then skip the instructions they replace.
+	// fuse never fuses instructions whose operand is the same as r1.
+	for r1, r := range registers {
+		for src := 0; src < 5; src++ {
+			if src == r1 {
+				continue
+			}
+			s, comment, first := "n", r+" n", ""
+			if src < 4 {
+				s, comment = registers[src], r+" "+registers[src]
+			} else {
+				first = "n = code[i+1].p2.n\n"
+			}
+			fmt.Fprintf(&buf, "case execSet + %d: // mul %s 0 ; add %s\n", r1*5+src, r, comment)
+			fmt.Fprintf(&buf, "%s%s = %s\ni++\n", first, r, s)
+
+			fmt.Fprintf(&buf, "case execSetAdd + %d: // mul %s 0 ; add %s ; add %s n\n", r1*5+src, r, comment, r)
+			fmt.Fprintf(&buf, "%s%s = %s + code[i+2].p2.n\ni += 2\n", first, r, s)
+
+			fmt.Fprintf(&buf, "case execNeq + %d: // eql %s ; eql %s 0\n", r1*5+src, comment, r)
+			fmt.Fprintf(&buf, "if %s != %s {\n%s = 1\n} else {\n%s = 0\n}\ni++\n", r, s, r, r)
+
+			fmt.Fprintf(&buf, "case execMulAdd + %d: // mul %s ; add %s n\n", r1*5+src, comment, r)
+			fmt.Fprintf(&buf, "%s = %s*%s + code[i+1].p2.n\ni++\n", r, r, s)
+		}
+	}
+
+	buf.WriteString(`			case execControl:
+				a.reg = [4]int{w, x, y, z}
+				return i, nil
+			}
+		}
+		break
+
+	input:
+		// the registers are saved and reloaded around the call, so
+		// that they are never live across it
+		a.reg = [4]int{w, x, y, z}
+		n, err := a.read(&code[i])
+		if err != nil {
+			return i, err
+		}
+		a.reg[code[i].r1&3] = n
+		w, x, y, z = a.reg[0], a.reg[1], a.reg[2], a.reg[3]
+		i++
+	}
+
+	a.reg = [4]int{w, x, y, z}
+	return i, nil
+}
+`)
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("exec_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// body returns the code for a single case of the switch statement.
+// The compiler prevents immediate zero divisors, so only register divisors
+// need to be checked.
+func body(op, r, s string, isRegister bool) string {
+	const save = "a.reg = [4]int{w, x, y, z}\n"
+
+	switch op {
+	case "inp":
+		return "goto input\n"
+
+	case "add":
+		return fmt.Sprintf("%s += %s\n", r, s)
+
+	case "mul":
+		return fmt.Sprintf("%s *= %s\n", r, s)
+
+	case "div", "mod":
+		fn, sym := "errDivide", "/"
+		if op == "mod" {
+			fn, sym = "errModulo", "%"
+		}
+		check := ""
+		if isRegister {
+			check = fmt.Sprintf("if %s == 0 {\n%sreturn i, %s(inst)\n}\n", s, save, fn)
+		}
+		return fmt.Sprintf("%s%s %s= %s\n", check, r, sym, s)
+
+	default: // eql
+		return fmt.Sprintf("if %s == %s {\n%s = 1\n} else {\n%s = 0\n}\n", r, s, r, r)
+	}
+}
@@ -0,0 +1,228 @@
+package alu
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// GenerateGo translates the program into the source code of a Go file, in
+// the given package, holding a single function with the given name:
+//
+//	func name(input []int) (w, x, y, z int, err error)
+//
+// The function behaves exactly like an ALU running the program with
+// Ints(input...): it returns the final value of each register, or the same
+// error as the ALU would. Jumps and calls are translated to goto
+// statements, so the generated code has no loops of its own.
+func GenerateGo(code Program, pkg, name string) ([]byte, error) {
+	g := goGen{code: code}
+	g.scan()
+	g.header(pkg, name)
+	for i := range code {
+		g.instruction(i)
+	}
+	if g.reach[len(code)] {
+		if g.targets[len(code)] {
+			fmt.Fprintf(&g.buf, "L%d:\n", len(code))
+		}
+		g.buf.WriteString("return w, x, y, z, nil\n")
+	}
+	g.buf.WriteString("}\n")
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "generated invalid Go code")
+	}
+	return src, nil
+}
+
+// goGen holds the state of the Go code generator.
+type goGen struct {
+	code    Program
+	buf     bytes.Buffer
+	reach   []bool       // reach holds true for each reachable index.
+	targets map[int]bool // targets holds each index that needs a label.
+	returns []int        // returns holds every return address.
+
+	// which variables and imports the code needs:
+	hasInput, hasReturn, hasErrors bool
+}
+
+// scan finds which instructions can be reached, and what they need.
+// Go rejects unused labels, and vet reports unreachable code, so nothing
+// is generated for instructions that can never run.
+func (g *goGen) scan() {
+	g.reach = make([]bool, len(g.code)+1)
+	g.targets = make(map[int]bool)
+
+	work := []int{0}
+	visit := func(i int) {
+		if !g.reach[i] {
+			g.reach[i] = true
+			work = append(work, i)
+		}
+	}
+	g.reach[0] = true
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i == len(g.code) {
+			continue
+		}
+
+		inst := g.code[i]
+		switch inst.op {
+		case opInput:
+			g.hasInput, g.hasErrors = true, true
+			visit(i + 1)
+
+		case opDivide, opModulo:
+			if _, ok := inst.p2.isRegister(); ok {
+				g.hasErrors = true
+			}
+			visit(i + 1)
+
+		case opJumpNotZero:
+			g.targets[inst.p2.n] = true
+			visit(inst.p2.n)
+			visit(i + 1)
+
+		case opJump:
+			g.targets[inst.p2.n] = true
+			visit(inst.p2.n)
+
+		case opCall:
+			g.targets[inst.p2.n] = true
+			g.returns = append(g.returns, i+1)
+			g.hasErrors = true
+			visit(inst.p2.n)
+			if g.hasReturn {
+				visit(i + 1)
+			}
+
+		case opReturn:
+			// only now can any call return, so its next instruction
+			// becomes reachable:
+			if !g.hasReturn {
+				g.hasReturn, g.hasErrors = true, true
+				for _, ret := range g.returns {
+					visit(ret)
+				}
+			}
+
+		default:
+			visit(i + 1)
+		}
+	}
+
+	sort.Ints(g.returns)
+	if g.hasReturn {
+		for _, ret := range g.returns {
+			g.targets[ret] = true
+		}
+	}
+}
+
+// header writes everything up to the first instruction.
+func (g *goGen) header(pkg, name string) {
+	fmt.Fprintf(&g.buf, "// Code generated by alu.GenerateGo; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if g.hasErrors {
+		g.buf.WriteString("import \"errors\"\n\n")
+	}
+
+	fmt.Fprintf(&g.buf, "// %s runs an ALU program, reading the values for its inp instructions\n", name)
+	g.buf.WriteString("// from input, and returns the final value of each register.\n")
+	fmt.Fprintf(&g.buf, "func %s(input []int) (w, x, y, z int, err error) {\n", name)
+
+	if g.hasInput {
+		g.buf.WriteString("next := 0\n")
+	}
+	if len(g.returns) > 0 {
+		g.buf.WriteString("var stack []int\n")
+		if g.hasReturn {
+			g.buf.WriteString("var top int\n")
+		}
+	}
+	if g.hasInput || len(g.returns) > 0 {
+		g.buf.WriteString("\n")
+	}
+}
+
+// fail writes a statement that returns an error for the instruction at the
+// given position, as described by instruction.where.
+func (g *goGen) fail(where string, msg string) {
+	fmt.Fprintf(&g.buf, "return w, x, y, z, errors.New(%q)\n",
+		fmt.Sprintf("execution failed on %s: %s", where, msg))
+}
+
+// instruction writes the code for the instruction at index i.
+func (g *goGen) instruction(i int) {
+	if !g.reach[i] {
+		return
+	}
+	if g.targets[i] {
+		fmt.Fprintf(&g.buf, "L%d:\n", i)
+	}
+
+	inst := g.code[i]
+	r, s := inst.r1.String(), inst.p2.String()
+	fmt.Fprintf(&g.buf, "// line %d: %s\n", inst.line, inst)
+
+	switch inst.op {
+	case opInput:
+		g.buf.WriteString("if next == len(input) {\n")
+		g.fail(inst.where(), "input requires an input value")
+		fmt.Fprintf(&g.buf, "}\n%s = input[next]\nnext++\n", r)
+
+	case opAdd:
+		fmt.Fprintf(&g.buf, "%s += %s\n", r, s)
+
+	case opMultiply:
+		fmt.Fprintf(&g.buf, "%s *= %s\n", r, s)
+
+	case opDivide, opModulo:
+		sym, msg := "/", "divide by 0"
+		if inst.op == opModulo {
+			sym, msg = "%", "modulo of 0 is undefined"
+		}
+		if _, ok := inst.p2.isRegister(); ok {
+			fmt.Fprintf(&g.buf, "if %s == 0 {\n", s)
+			g.fail(inst.where(), msg)
+			g.buf.WriteString("}\n")
+		}
+		fmt.Fprintf(&g.buf, "%s %s= %s\n", r, sym, s)
+
+	case opEquals:
+		fmt.Fprintf(&g.buf, "if %s == %s {\n%s = 1\n} else {\n%s = 0\n}\n", r, s, r, r)
+
+	case opJumpNotZero:
+		fmt.Fprintf(&g.buf, "if %s != 0 {\ngoto L%d\n}\n", r, inst.p2.n)
+
+	case opJump:
+		fmt.Fprintf(&g.buf, "goto L%d\n", inst.p2.n)
+
+	case opCall:
+		fmt.Fprintf(&g.buf, "if len(stack) == %d {\n", MaxCallDepth)
+		g.fail(inst.where(), "call stack overflow")
+		fmt.Fprintf(&g.buf, "}\nstack = append(stack, %d)\ngoto L%d\n", i+1, inst.p2.n)
+
+	case opReturn:
+		if len(g.returns) == 0 {
+			g.fail(inst.where(), "return without a call")
+			return
+		}
+		g.buf.WriteString("if len(stack) == 0 {\n")
+		g.fail(inst.where(), "return without a call")
+		g.buf.WriteString("}\ntop, stack = stack[len(stack)-1], stack[:len(stack)-1]\nswitch top {\n")
+		last := len(g.returns) - 1
+		for _, ret := range g.returns[:last] {
+			fmt.Fprintf(&g.buf, "case %d:\ngoto L%d\n", ret, ret)
+		}
+		fmt.Fprintf(&g.buf, "default: // %d\ngoto L%d\n}\n", g.returns[last], g.returns[last])
+	}
+}
@@ -0,0 +1,81 @@
+package alu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The generated code is compiled and checked against the interpreter by the
+// tests for cmd/alu-gen and cmd/day24. These tests check the edge cases of
+// the generator's output.
+func TestGenerateGo(t *testing.T) {
+	tt := []struct {
+		name    string
+		program string
+		want    string
+	}{
+		{
+			name:    "a program that cannot fail needs no imports",
+			program: "add z 3\nmul z w\n",
+			want: `// Code generated by alu.GenerateGo; DO NOT EDIT.
+
+package p
+
+// f runs an ALU program, reading the values for its inp instructions
+// from input, and returns the final value of each register.
+func f(input []int) (w, x, y, z int, err error) {
+	// line 1: add z 3
+	z += 3
+	// line 2: mul z w
+	z *= w
+	return w, x, y, z, nil
+}
+`,
+		},
+		{
+			name:    "unreachable instructions and unused labels are left out",
+			program: "call sub\nadd z 1\nsub: jmp end\nadd z 2\nend:\n",
+			want: `// Code generated by alu.GenerateGo; DO NOT EDIT.
+
+package p
+
+import "errors"
+
+// f runs an ALU program, reading the values for its inp instructions
+// from input, and returns the final value of each register.
+func f(input []int) (w, x, y, z int, err error) {
+	var stack []int
+
+	// line 1: call sub
+	if len(stack) == 1024 {
+		return w, x, y, z, errors.New("execution failed on line 1: call stack overflow")
+	}
+	stack = append(stack, 1)
+	goto L2
+L2:
+	// line 3: jmp end
+	goto L4
+L4:
+	return w, x, y, z, nil
+}
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			got, err := GenerateGo(code, "p", "f")
+			r.NoError(err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package alu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Input supplies the values that a program reads with inp instructions.
+type Input interface {
+	// Next returns the next input value. It returns io.EOF when there are
+	// no more values, or some other error if the value cannot be read.
+	Next() (int, error)
+}
+
+// EndOfInputError is returned when an inp instruction runs out of input.
+type EndOfInputError struct {
+	File string // File is the name of the inp instruction's file, or "" for the source given to Compile.
+	Line int    // Line is the source line of the inp instruction.
+}
+
+// Error implements error.
+func (e *EndOfInputError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("execution failed on %s:%d: input requires an input value", e.File, e.Line)
+	}
+	return fmt.Sprintf("execution failed on line %d: input requires an input value", e.Line)
+}
+
+// Digits makes an Input that reads each character of s as one decimal digit,
+// so that Digits("13579") gives the values 1, 3, 5, 7 and 9.
+func Digits(s string) Input {
+	return &digits{s: s}
+}
+
+type digits struct {
+	s   string
+	off int
+}
+
+// Next implements Input.
+func (d *digits) Next() (int, error) {
+	if d.off >= len(d.s) {
+		return 0, io.EOF
+	}
+	c := d.s[d.off]
+	if !isDigit(c) {
+		return 0, errors.Errorf("invalid digit %q at offset %d", c, d.off)
+	}
+	d.off++
+	return int(c - '0'), nil
+}
+
+// Ints makes an Input that reads the given values in order.
+func Ints(values ...int) Input {
+	return &ints{values: values}
+}
+
+type ints struct {
+	values []int
+}
+
+// Next implements Input.
+func (in *ints) Next() (int, error) {
+	if len(in.values) == 0 {
+		return 0, io.EOF
+	}
+	n := in.values[0]
+	in.values = in.values[1:]
+	return n, nil
+}
+
+// Text makes an Input that reads whitespace-separated decimal integers
+// from r. Each integer may have a leading sign.
+func Text(r io.Reader) Input {
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanWords)
+	return &text{s: s}
+}
+
+type text struct {
+	s *bufio.Scanner
+}
+
+// Next implements Input.
+func (t *text) Next() (int, error) {
+	if !t.s.Scan() {
+		if err := t.s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	n, err := strconv.Atoi(t.s.Text())
+	if err != nil {
+		return 0, errors.Errorf("invalid number %q", t.s.Text())
+	}
+	return n, nil
+}
+
+// Chan makes an Input that receives values from ch. The input ends when
+// ch is closed.
+func Chan(ch <-chan int) Input {
+	return chanInput(ch)
+}
+
+type chanInput <-chan int
+
+// Next implements Input.
+func (ch chanInput) Next() (int, error) {
+	n, ok := <-ch
+	if !ok {
+		return 0, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,114 @@
+package alu
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInput(t *testing.T) {
+	closed := func(values ...int) <-chan int {
+		ch := make(chan int, len(values))
+		for _, n := range values {
+			ch <- n
+		}
+		close(ch)
+		return ch
+	}
+
+	tt := []struct {
+		name    string
+		in      Input
+		want    []int
+		wantErr string
+	}{
+		{
+			name: "digits",
+			in:   Digits("13579"),
+			want: []int{1, 3, 5, 7, 9},
+		},
+		{
+			name:    "digits with an invalid character",
+			in:      Digits("12x"),
+			want:    []int{1, 2},
+			wantErr: `invalid digit 'x' at offset 2`,
+		},
+		{
+			name: "ints",
+			in:   Ints(-1, 0, 300),
+			want: []int{-1, 0, 300},
+		},
+		{
+			name: "no ints",
+			in:   Ints(),
+		},
+		{
+			name: "text",
+			in:   Text(strings.NewReader(" 12 -7\n+3\t\n0 ")),
+			want: []int{12, -7, 3, 0},
+		},
+		{
+			name:    "text with an invalid number",
+			in:      Text(strings.NewReader("4 5a 6")),
+			want:    []int{4},
+			wantErr: `invalid number "5a"`,
+		},
+		{
+			name: "channel",
+			in:   Chan(closed(9, 8, -1000)),
+			want: []int{9, 8, -1000},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			var got []int
+			for {
+				n, err := tc.in.Next()
+				if err == io.EOF {
+					r.Empty(tc.wantErr)
+					break
+				}
+				if err != nil {
+					r.EqualError(err, tc.wantErr)
+					break
+				}
+				got = append(got, n)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_input(t *testing.T) {
+	code, err := Compile([]byte("inp w\ninp x\nadd x w\ninp z\nadd z x\n"))
+	require.NoError(t, err)
+	calc := New(code)
+
+	t.Run("values outside 0-255", func(t *testing.T) {
+		got, err := calc.Run(Ints(-500, 1000, 7))
+		require.NoError(t, err)
+		assert.Equal(t, 507, got)
+	})
+
+	t.Run("running out of input", func(t *testing.T) {
+		_, err := calc.Run(Digits("12"))
+		var eoi *EndOfInputError
+		require.True(t, errors.As(err, &eoi), "got %T, want *EndOfInputError", err)
+		assert.Equal(t, 4, eoi.Line)
+		assert.EqualError(t, err, "execution failed on line 4: input requires an input value")
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, err := calc.Run(Text(strings.NewReader("1 two 3")))
+		assert.EqualError(t, err, `execution failed on line 2: invalid number "two"`)
+	})
+}
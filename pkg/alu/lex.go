@@ -0,0 +1,183 @@
+package alu
+
+import "fmt"
+
+// tokenKind identifies the type of a lexical token in ALU source code.
+type tokenKind byte
+
+const (
+	tokEOF     tokenKind = iota // end of input
+	tokNewline                  // end of a line
+	tokIdent                    // an opcode, a register name or a label
+	tokNumber                   // a decimal integer, optionally signed
+	tokColon                    // the ':' that ends a label definition
+	tokString                   // a double-quoted file name, for include
+	tokIllegal                  // a character that cannot start any token
+)
+
+// String implements fmt.Stringer, for use in error messages.
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of input"
+	case tokNewline:
+		return "end of line"
+	case tokIdent:
+		return "identifier"
+	case tokNumber:
+		return "number"
+	case tokColon:
+		return "':'"
+	case tokString:
+		return "string"
+	default:
+		return "illegal character"
+	}
+}
+
+// token is a single lexical element, along with its position in the source.
+// Lines and columns are both numbered from 1; columns count bytes.
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+	src  *srcInfo // src is nil for tokens from the source given to Compile.
+}
+
+// srcInfo describes where some source code came from, beyond its line.
+type srcInfo struct {
+	file string // file is the name of the file, if there is one.
+
+	// For code from a macro, expansion gives the line of the macro's body
+	// that the code came from, such as "lib.alu:2 in macro push", and
+	// callFile and callLine give the place where the macro was used,
+	// outside of any other macro. An instruction from a macro takes its
+	// position from that place.
+	expansion string
+	callFile  string
+	callLine  int
+}
+
+// instFile returns the file of an instruction made from this source.
+func (s *srcInfo) instFile() string {
+	if s == nil {
+		return ""
+	}
+	if s.expansion != "" {
+		return s.callFile
+	}
+	return s.file
+}
+
+// position formats the given line of a source, such as "main.alu:12".
+func (s *srcInfo) position(line int) string {
+	if s == nil || s.file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", s.file, line)
+}
+
+// lexer splits ALU source code into tokens.
+//
+// Spaces, tabs and carriage returns separate tokens but are otherwise
+// ignored, so CRLF line endings are fine. A '#' starts a comment which runs
+// to the end of the line.
+type lexer struct {
+	info *srcInfo // info is given to every token.
+	src  []byte
+	off  int // off is the offset of the next unread byte
+	line int // line is the line number of the next unread byte
+	col  int // col is the column number of the next unread byte
+}
+
+// newLexer initializes a lexer that will read the given source code.
+func newLexer(src []byte) *lexer {
+	return &lexer{src: src, line: 1, col: 1}
+}
+
+// next scans and returns the next token. Once the input is exhausted, next
+// keeps returning a tokEOF token.
+func (l *lexer) next() token {
+	l.skipSpace()
+
+	tok := token{line: l.line, col: l.col, src: l.info}
+	if l.off >= len(l.src) {
+		tok.kind = tokEOF
+		return tok
+	}
+
+	start := l.off
+	switch b := l.src[l.off]; {
+	case b == '\n':
+		l.off++
+		l.line, l.col = l.line+1, 1
+		tok.kind, tok.text = tokNewline, "\n"
+		return tok
+
+	case isLetter(b):
+		for l.off < len(l.src) && (isLetter(l.src[l.off]) || isDigit(l.src[l.off])) {
+			l.off++
+		}
+		tok.kind = tokIdent
+
+	case b == ':':
+		l.off++
+		tok.kind = tokColon
+
+	case b == '"':
+		l.off++
+		for l.off < len(l.src) && l.src[l.off] != '"' && l.src[l.off] != '\n' {
+			l.off++
+		}
+		if l.off < len(l.src) && l.src[l.off] == '"' {
+			l.off++
+			tok.kind = tokString
+		} else {
+			tok.kind = tokIllegal
+		}
+
+	case isDigit(b), (b == '-' || b == '+') && l.off+1 < len(l.src) && isDigit(l.src[l.off+1]):
+		l.off++
+		for l.off < len(l.src) && isDigit(l.src[l.off]) {
+			l.off++
+		}
+		tok.kind = tokNumber
+
+	default:
+		l.off++
+		tok.kind = tokIllegal
+	}
+
+	tok.text = string(l.src[start:l.off])
+	l.col += l.off - start
+	return tok
+}
+
+// skipSpace advances past whitespace (other than newlines) and comments.
+func (l *lexer) skipSpace() {
+	for l.off < len(l.src) {
+		switch l.src[l.off] {
+		case ' ', '\t', '\r', '\v', '\f':
+			l.off++
+			l.col++
+
+		case '#':
+			for l.off < len(l.src) && l.src[l.off] != '\n' {
+				l.off++
+				l.col++
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || b == '_'
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
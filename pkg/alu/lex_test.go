@@ -0,0 +1,31 @@
+package alu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexer(t *testing.T) {
+	l := newLexer([]byte("inp w\r\n\tadd x -12 # comment\n+3 ! top:"))
+
+	want := []token{
+		{kind: tokIdent, text: "inp", line: 1, col: 1},
+		{kind: tokIdent, text: "w", line: 1, col: 5},
+		{kind: tokNewline, text: "\n", line: 1, col: 7},
+		{kind: tokIdent, text: "add", line: 2, col: 2},
+		{kind: tokIdent, text: "x", line: 2, col: 6},
+		{kind: tokNumber, text: "-12", line: 2, col: 8},
+		{kind: tokNewline, text: "\n", line: 2, col: 21},
+		{kind: tokNumber, text: "+3", line: 3, col: 1},
+		{kind: tokIllegal, text: "!", line: 3, col: 4},
+		{kind: tokIdent, text: "top", line: 3, col: 6},
+		{kind: tokColon, text: ":", line: 3, col: 9},
+		{kind: tokEOF, line: 3, col: 10},
+		{kind: tokEOF, line: 3, col: 10},
+	}
+
+	for i, w := range want {
+		assert.Equal(t, w, l.next(), "token %d", i)
+	}
+}
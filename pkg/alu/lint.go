@@ -0,0 +1,224 @@
+package alu
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Rule is a set of lint rules. Rules can be combined with '|'.
+type Rule uint8
+
+const (
+	// UninitializedRead warns about instructions that read a register
+	// before anything has written to it. Registers start at 0, so this is
+	// not an error, but it is often a mistake.
+	UninitializedRead Rule = 1 << iota
+
+	// DeadStore warns about instructions whose result is always
+	// overwritten before it is read. Every register is read at the end of
+	// the program, and inp instructions are never reported, since reading
+	// an input has an effect of its own.
+	DeadStore
+
+	// UselessOp warns about instructions that never change their register,
+	// such as 'add x 0', 'mul x 1' and 'div x 1'.
+	UselessOp
+
+	// AllRules enables every rule.
+	AllRules = UninitializedRead | DeadStore | UselessOp
+)
+
+var ruleNames = map[Rule]string{
+	UninitializedRead: "uninitialized-read",
+	DeadStore:         "dead-store",
+	UselessOp:         "useless-op",
+}
+
+// String implements fmt.Stringer, returning the ID of a single rule.
+func (r Rule) String() string {
+	if name, ok := ruleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Rule(%d)", uint8(r))
+}
+
+// Warning describes a single problem found by Lint.
+type Warning struct {
+	Line int    // Line is the source line of the instruction.
+	Rule Rule   // Rule is the single rule that found the problem.
+	Msg  string // Msg describes the problem.
+}
+
+// String implements fmt.Stringer.
+func (w Warning) String() string {
+	return fmt.Sprintf("line %d: %s [%s]", w.Line, w.Msg, w.Rule)
+}
+
+// Lint checks the program against the selected rules, and returns a warning
+// for each problem it finds, sorted by line. Unlike the errors from
+// Compile, warnings never stop a program from running. Instructions that
+// can never run are not checked.
+func Lint(code Program, rules Rule) []Warning {
+	l := linter{code: code, succ: successors(code)}
+	l.reachable()
+
+	if rules&UninitializedRead != 0 {
+		l.uninitializedReads()
+	}
+	if rules&DeadStore != 0 {
+		l.deadStores()
+	}
+	if rules&UselessOp != 0 {
+		l.uselessOps()
+	}
+
+	sort.SliceStable(l.warnings, func(i, j int) bool {
+		return l.warnings[i].Line < l.warnings[j].Line
+	})
+	return l.warnings
+}
+
+// linter holds the state of a single call to Lint.
+type linter struct {
+	code     Program
+	succ     [][]int // succ holds the successors of each instruction.
+	reach    []bool
+	warnings []Warning
+}
+
+func (l *linter) warn(line int, rule Rule, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Warning{Line: line, Rule: rule, Msg: fmt.Sprintf(format, args...)})
+}
+
+// successors returns the indexes of the instructions that might run after
+// each instruction, where len(code) is the end of the program. A ret might
+// return to after any call.
+func successors(code Program) [][]int {
+	var returns []int
+	for i, inst := range code {
+		if inst.op == opCall {
+			returns = append(returns, i+1)
+		}
+	}
+
+	succ := make([][]int, len(code))
+	for i, inst := range code {
+		switch inst.op {
+		case opJumpNotZero:
+			succ[i] = []int{inst.p2.n, i + 1}
+		case opJump, opCall:
+			succ[i] = []int{inst.p2.n}
+		case opReturn:
+			succ[i] = returns
+		default:
+			succ[i] = []int{i + 1}
+		}
+	}
+	return succ
+}
+
+// reachable finds which instructions might run.
+func (l *linter) reachable() {
+	l.reach = make([]bool, len(l.code)+1)
+	l.reach[0] = true
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i == len(l.code) {
+			continue
+		}
+		for _, next := range l.succ[i] {
+			if !l.reach[next] {
+				l.reach[next] = true
+				work = append(work, next)
+			}
+		}
+	}
+}
+
+// uninitializedReads finds which registers might not have been written
+// before each instruction, and warns about any that the instruction reads.
+func (l *linter) uninitializedReads() {
+	// unset is a bit mask, in the same form as liveness
+	unset := make([]uint8, len(l.code)+1)
+	unset[0] = 0b1111
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i == len(l.code) {
+			continue
+		}
+		_, def := usesDefs(l.code[i])
+		out := unset[i] &^ def
+		for _, next := range l.succ[i] {
+			if merged := unset[next] | out; merged != unset[next] {
+				unset[next] = merged
+				work = append(work, next)
+			}
+		}
+	}
+
+	for i, inst := range l.code {
+		if !l.reach[i] {
+			continue
+		}
+		use, _ := usesDefs(inst)
+		for r := registerID(0); r < 4; r++ {
+			if use&unset[i]&(1<<r) != 0 {
+				l.warn(inst.line, UninitializedRead, "%s is read before it is written", r)
+			}
+		}
+	}
+}
+
+// deadStores finds which registers are live after each instruction, and
+// warns about instructions that write a register which is not.
+func (l *linter) deadStores() {
+	// liveIn holds the registers that are live before each instruction,
+	// and every register is live at the end:
+	liveIn := make([]uint8, len(l.code)+1)
+	liveIn[len(l.code)] = 0b1111
+	liveOut := func(i int) uint8 {
+		var out uint8
+		for _, next := range l.succ[i] {
+			out |= liveIn[next]
+		}
+		return out
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(l.code) - 1; i >= 0; i-- {
+			use, def := usesDefs(l.code[i])
+			in := liveOut(i)&^def | use
+			if in != liveIn[i] {
+				liveIn[i], changed = in, true
+			}
+		}
+	}
+
+	for i, inst := range l.code {
+		if !l.reach[i] || inst.op == opInput {
+			continue
+		}
+		if _, def := usesDefs(inst); def&^liveOut(i) != 0 {
+			l.warn(inst.line, DeadStore, "the value written to %s is never read", inst.r1)
+		}
+	}
+}
+
+// uselessOps warns about instructions that never change their register.
+func (l *linter) uselessOps() {
+	for i, inst := range l.code {
+		if !l.reach[i] || inst.p2.kind != immediateOperand {
+			continue
+		}
+		n := inst.p2.n
+		if inst.op == opAdd && n == 0 ||
+			(inst.op == opMultiply || inst.op == opDivide) && n == 1 {
+			l.warn(inst.line, UselessOp, "%s has no effect", inst)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package alu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	tt := []struct {
+		name    string
+		program string
+		rules   Rule
+		want    []string
+	}{
+		{
+			name:    "a clean program",
+			program: "inp w\nmul z 0\nadd z w\n",
+			rules:   AllRules,
+		},
+		{
+			name:    "reading a register before writing it",
+			program: "inp w\nadd w x\nmul y 0\nadd y 1\neql y z\n",
+			rules:   UninitializedRead,
+			want: []string{
+				"line 2: x is read before it is written [uninitialized-read]",
+				"line 5: z is read before it is written [uninitialized-read]",
+			},
+		},
+		{
+			name:    "a register that is written on only one path",
+			program: "inp w\njnz w skip\nmul x 0\nskip: add y x\nadd y x\n",
+			rules:   UninitializedRead,
+			want: []string{
+				"line 4: x is read before it is written [uninitialized-read]",
+				"line 4: y is read before it is written [uninitialized-read]",
+				"line 5: x is read before it is written [uninitialized-read]",
+			},
+		},
+		{
+			name:    "values that are overwritten before they are read",
+			program: "inp w\nadd x w\nmul x 0\ninp w\nadd z w\nmul y 0\nadd y z\n",
+			rules:   DeadStore,
+			want: []string{
+				"line 2: the value written to x is never read [dead-store]",
+			},
+		},
+		{
+			name:    "a value that is read by a loop is not dead",
+			program: "inp w\nloop: add z w\nadd w -1\njnz w loop\nmul w 0\n",
+			rules:   DeadStore,
+		},
+		{
+			name:    "useless operations",
+			program: "add x 0\nmul x 1\ndiv x 1\nmod x 1\nadd x y\n",
+			rules:   UselessOp,
+			want: []string{
+				"line 1: add x 0 has no effect [useless-op]",
+				"line 2: mul x 1 has no effect [useless-op]",
+				"line 3: div x 1 has no effect [useless-op]",
+			},
+		},
+		{
+			name:    "unreachable instructions are not checked",
+			program: "jmp end\nadd x 0\nend:\n",
+			rules:   AllRules,
+		},
+		{
+			name:    "only the selected rules are checked",
+			program: "add x 0\nadd y z\nmul y 0\n",
+			rules:   UselessOp | UninitializedRead,
+			want: []string{
+				"line 1: x is read before it is written [uninitialized-read]",
+				"line 1: add x 0 has no effect [useless-op]",
+				"line 2: y is read before it is written [uninitialized-read]",
+				"line 2: z is read before it is written [uninitialized-read]",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			code, err := Compile([]byte(tc.program))
+			require.NoError(t, err)
+
+			var got []string
+			for _, w := range Lint(code, tc.rules) {
+				got = append(got, w.String())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRule_String(t *testing.T) {
+	assert.Equal(t, "dead-store", DeadStore.String())
+	assert.Equal(t, "Rule(7)", AllRules.String())
+}
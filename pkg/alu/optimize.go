@@ -0,0 +1,257 @@
+package alu
+
+// Pass is a set of optimization passes. Passes can be combined with '|'.
+type Pass uint8
+
+const (
+	// ConstProp tracks registers whose values are known at compile time.
+	// It replaces register operands with immediate values, and replaces
+	// instructions that have a known result with a single add (or nothing).
+	ConstProp Pass = 1 << iota
+
+	// DeadStores removes instructions whose results are overwritten before
+	// they are read. Instructions that read input, or which could fail at
+	// run time, are always kept.
+	DeadStores
+
+	// Simplify rewrites or removes instructions that are algebraic
+	// identities, such as 'add x 0', 'mul x 1' and 'div x 1'.
+	Simplify
+
+	// Peephole fuses adjacent instructions that can be done in one step,
+	// such as 'add x 2' followed by 'add x 3'.
+	Peephole
+
+	// AllPasses enables every optimization.
+	AllPasses = ConstProp | DeadStores | Simplify | Peephole
+)
+
+// passes lists each optimization in the order they are applied.
+var passes = []struct {
+	pass Pass
+	fn   func(Program) Program
+}{
+	{ConstProp, constProp},
+	{Simplify, simplify},
+	{Peephole, peephole},
+	{DeadStores, deadStores},
+}
+
+// Optimize applies the selected passes to the program, repeating them until
+// the program stops changing. The given program is not modified.
+//
+// The result runs with the same input, gives the same output (or error), and
+// leaves the same values in every register as the original program, when
+// both run on an ALU made by New. The passes fold constants with 64-bit
+// arithmetic that wraps around, so that is not true for an ALU with other
+// Options. Each remaining instruction keeps its original line number.
+//
+// The passes only understand straight-line code, so a program with any
+// control flow instructions is returned unchanged.
+func Optimize(code Program, selected Pass) Program {
+	out := append(Program(nil), code...)
+	if straightLine(code) != nil {
+		return out
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range passes {
+			if selected&p.pass == 0 {
+				continue
+			}
+			next := p.fn(out)
+			if !sameProgram(next, out) {
+				changed = true
+			}
+			out = next
+		}
+	}
+	return out
+}
+
+// sameProgram checks if two programs have identical instructions.
+func sameProgram(a, b Program) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].op != b[i].op || a[i].r1 != b[i].r1 || a[i].p2 != b[i].p2 {
+			return false
+		}
+	}
+	return true
+}
+
+// constProp performs constant propagation. Every register starts at 0,
+// and remains known until it is set from input or from an unknown register.
+func constProp(code Program) Program {
+	var (
+		out   = make(Program, 0, len(code))
+		known = [4]bool{true, true, true, true}
+		val   [4]int
+	)
+
+	for _, inst := range code {
+		r := inst.r1
+		if inst.op == opInput {
+			known[r] = false
+			out = append(out, inst)
+			continue
+		}
+
+		// replace a known register operand with its value, unless that
+		// would turn a run-time error into a compile-time one:
+		if r2, ok := inst.p2.isRegister(); ok && known[r2] {
+			if n := val[r2]; n != 0 || (inst.op != opDivide && inst.op != opModulo) {
+				inst = mustInstruction(inst.op, inst.r1, immOperand(n), inst.line)
+			}
+		}
+
+		n, isImmediate := inst.p2.isImmediate()
+		switch {
+		case known[r] && isImmediate:
+			result, err := apply(exprOps[inst.op], val[r], n)
+			if err != nil {
+				out = append(out, inst)
+				known[r] = false
+				continue
+			}
+			if result != val[r] {
+				out = append(out, mustInstruction(opAdd, inst.r1, immOperand(result-val[r]), inst.line))
+				val[r] = result
+			}
+
+		case known[r] && val[r] == 0 && inst.op == opMultiply:
+			// 0 * anything = 0, so there is nothing to do
+
+		case isImmediate && n == 0 && inst.op == opMultiply:
+			out = append(out, inst)
+			known[r], val[r] = true, 0
+
+		default:
+			out = append(out, inst)
+			known[r] = false
+		}
+	}
+
+	return out
+}
+
+// deadStores removes instructions that write to a register which will be
+// overwritten before it is next read. Every register is live at the end of
+// the program, so that the final state of the ALU is unchanged.
+func deadStores(code Program) Program {
+	keep := make([]bool, len(code))
+	live := uint8(0b1111)
+	for i := len(code) - 1; i >= 0; i-- {
+		inst := code[i]
+		use, def := usesDefs(inst)
+		if live&def == 0 && !mayFail(inst) {
+			continue
+		}
+		keep[i] = true
+		live = live&^def | use
+	}
+
+	out := make(Program, 0, len(code))
+	for i, inst := range code {
+		if keep[i] {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// mayFail checks if the instruction could fail, or otherwise has an effect
+// other than setting the value of its first register.
+func mayFail(inst instruction) bool {
+	switch inst.op {
+	case opInput:
+		return true
+	case opDivide, opModulo:
+		_, isRegister := inst.p2.isRegister()
+		return isRegister
+	default:
+		return false
+	}
+}
+
+// simplify removes or rewrites algebraic identities.
+func simplify(code Program) Program {
+	out := make(Program, 0, len(code))
+	for _, inst := range code {
+		switch p2 := inst.p2.n; inst.p2.kind {
+		case immediateOperand:
+			switch {
+			case inst.op == opAdd && p2 == 0,
+				inst.op == opMultiply && p2 == 1,
+				inst.op == opDivide && p2 == 1:
+				continue
+
+			case inst.op == opModulo && (p2 == 1 || p2 == -1):
+				inst = mustInstruction(opMultiply, inst.r1, immOperand(0), inst.line)
+			}
+
+		case registerOperand:
+			if inst.op == opAdd && inst.p2.reg == inst.r1 {
+				inst = mustInstruction(opMultiply, inst.r1, immOperand(2), inst.line)
+			}
+		}
+		out = append(out, inst)
+	}
+	return out
+}
+
+// peephole fuses pairs of adjacent instructions with immediate operands
+// that act on the same register.
+func peephole(code Program) Program {
+	out := make(Program, 0, len(code))
+	for _, inst := range code {
+		if len(out) == 0 {
+			out = append(out, inst)
+			continue
+		}
+
+		prev := out[len(out)-1]
+		a, ok1 := prev.p2.isImmediate()
+		b, ok2 := inst.p2.isImmediate()
+		if !ok1 || !ok2 || prev.r1 != inst.r1 || prev.op != inst.op {
+			out = append(out, inst)
+			continue
+		}
+
+		switch inst.op {
+		case opAdd:
+			// wrapping addition is associative, even if it overflows
+			out[len(out)-1] = mustInstruction(opAdd, inst.r1, immOperand(a+b), prev.line)
+
+		case opMultiply:
+			// as is wrapping multiplication
+			out[len(out)-1] = mustInstruction(opMultiply, inst.r1, immOperand(a*b), prev.line)
+
+		case opDivide:
+			// truncating twice is the same as truncating once, provided
+			// that the combined divisor does not overflow. A negative
+			// divisor could be -1, and MinInt / -1 wraps around.
+			if ab, ok := mulExact(a, b); ok && a > 0 && b > 0 {
+				out[len(out)-1] = mustInstruction(opDivide, inst.r1, immOperand(ab), prev.line)
+			} else {
+				out = append(out, inst)
+			}
+
+		default:
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// mustInstruction assembles an instruction from parts that are known to be
+// valid, and panics if they are not.
+func mustInstruction(op opcode, r1 registerID, p2 operand, line int) instruction {
+	inst, err := newInstruction(op, r1, p2, line)
+	if err != nil {
+		panic(err)
+	}
+	return inst
+}
@@ -0,0 +1,218 @@
+package alu
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimize(t *testing.T) {
+	tt := []struct {
+		name    string
+		program string
+		passes  Pass
+		want    string
+	}{
+		{
+			name:    "constant propagation folds known values",
+			program: "add x 3\nmul x 4\nadd y x\nadd z y\nmod z 5\n",
+			passes:  ConstProp,
+			want:    "add x 3\nadd x 9\nadd y 12\nadd z 12\nadd z -10\n",
+		},
+		{
+			name:    "constant propagation replaces known registers",
+			program: "inp w\nadd x 2\nmul w x\n",
+			passes:  ConstProp,
+			want:    "inp w\nadd x 2\nmul w 2\n",
+		},
+		{
+			name:    "constant propagation keeps division by a zero register",
+			program: "inp w\ndiv w x\n",
+			passes:  ConstProp,
+			want:    "inp w\ndiv w x\n",
+		},
+		{
+			name:    "constant propagation skips multiplying zero",
+			program: "inp w\nmul x w\nmul y 0\nadd y w\n",
+			passes:  ConstProp,
+			want:    "inp w\nadd y w\n",
+		},
+		{
+			name:    "dead stores are removed",
+			program: "inp w\nadd x w\nmul x 0\nadd x 1\ninp w\n",
+			passes:  DeadStores,
+			want:    "inp w\nmul x 0\nadd x 1\ninp w\n",
+		},
+		{
+			name:    "dead stores keep instructions that might fail",
+			program: "inp w\ndiv x w\nmod y w\nmul x 0\nmul y 0\n",
+			passes:  DeadStores,
+			want:    "inp w\ndiv x w\nmod y w\nmul x 0\nmul y 0\n",
+		},
+		{
+			name:    "identities are simplified",
+			program: "inp w\nadd w 0\nmul w 1\ndiv w 1\nadd w w\nmod w 1\n",
+			passes:  Simplify,
+			want:    "inp w\nmul w 2\nmul w 0\n",
+		},
+		{
+			name:    "adjacent instructions are fused",
+			program: "inp w\nadd w 2\nadd w 3\nmul w 2\nmul w 3\ndiv w 2\ndiv w 3\ndiv x 2\n",
+			passes:  Peephole,
+			want:    "inp w\nadd w 5\nmul w 6\ndiv w 6\ndiv x 2\n",
+		},
+		{
+			name:    "division by a negative number is not fused",
+			program: "inp y\ndiv y -1\ndiv y 3\ndiv y 2\ndiv y 4\n",
+			passes:  Peephole,
+			want:    "inp y\ndiv y -1\ndiv y 24\n",
+		},
+		{
+			name:    "programs with control flow are unchanged",
+			program: "add x 0\nloop: add x 2\nadd x 3\njnz y loop\n",
+			passes:  AllPasses,
+			want:    "add x 0\nloop: add x 2\nadd x 3\njnz y loop\n",
+		},
+		{
+			name:    "no passes",
+			program: "add x 0\nadd x 0\n",
+			passes:  0,
+			want:    "add x 0\nadd x 0\n",
+		},
+		{
+			name:    "all passes",
+			program: "inp w\nmul x 0\nadd x z\nmod x 26\ndiv z 1\nadd x 12\neql x w\neql x 0\nadd z x\n",
+			passes:  AllPasses,
+			want:    "inp w\nadd x 12\neql x w\neql x 0\nadd z x\n",
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+			before := fmt.Sprint(code)
+
+			got := Optimize(code, tc.passes)
+			assert.Equal(t, tc.want, fmt.Sprint(got))
+			assert.Equal(t, before, fmt.Sprint(code), "the input program was modified")
+		})
+	}
+}
+
+func TestOptimize_keepsLineNumbers(t *testing.T) {
+	code, err := Compile([]byte("inp w\nadd w 0\nadd w 2\nadd w 3\n"))
+	require.NoError(t, err)
+
+	got := Optimize(code, AllPasses)
+	assert.Equal(t, "1  inp w\n3  add w 5\n", fmt.Sprintf("%+v", got))
+}
+
+// TestOptimize_minInt checks that the optimized program gives the same
+// registers as the original when dividing MinInt by -1 wraps around.
+func TestOptimize_minInt(t *testing.T) {
+	r := require.New(t)
+
+	code, err := Compile([]byte("inp y\ndiv y -1\ndiv y 3\n"))
+	r.NoError(err)
+
+	original := New(code)
+	_, err = original.Run(Ints(math.MinInt))
+	r.NoError(err)
+
+	optimized := New(Optimize(code, AllPasses))
+	_, err = optimized.Run(Ints(math.MinInt))
+	r.NoError(err)
+
+	r.Equal(math.MinInt/3, optimized.Snapshot().Registers.Y)
+	r.Equal(original.Snapshot().Registers, optimized.Snapshot().Registers)
+}
+
+// TestOptimize_options checks that optimized programs keep their meaning
+// with the default arithmetic, which is what the passes use to fold
+// constants, but not with other options.
+func TestOptimize_options(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+	small := Options{Width: Width8, Overflow: SaturateOverflow}
+
+	// saturating at 127 makes the order of the additions matter:
+	code, err := Compile([]byte("add z 127\nadd z 1\nadd z -1\n"))
+	r.NoError(err)
+	opt := Optimize(code, AllPasses)
+	a.Equal("add z 127\n", fmt.Sprint(opt))
+
+	want, err := New(code).Run(nil)
+	r.NoError(err)
+	got, err := New(opt).Run(nil)
+	r.NoError(err)
+	a.Equal(want, got)
+
+	calc, err := NewWithOptions(code, small)
+	r.NoError(err)
+	want, err = calc.Run(nil)
+	r.NoError(err)
+	calc, err = NewWithOptions(opt, small)
+	r.NoError(err)
+	got, err = calc.Run(nil)
+	r.NoError(err)
+	a.Equal(126, want)
+	a.Equal(127, got)
+
+	// folding the multiplications makes an operand that is too big:
+	code, err = Compile([]byte("inp w\nmul w 100\nmul w 100\n"))
+	r.NoError(err)
+	opt = Optimize(code, AllPasses)
+	a.Equal("inp w\nmul w 10000\n", fmt.Sprint(opt))
+
+	_, err = NewWithOptions(code, small)
+	r.NoError(err)
+	_, err = NewWithOptions(opt, small)
+	a.EqualError(err, "line 2: 10000 does not fit in 8 bits")
+}
+
+// TestOptimize_day24 checks that the optimized day 24 program gives the same
+// results as the original, for each selection of passes.
+func TestOptimize_day24(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+
+	code, err := Compile(src)
+	r.NoError(err)
+
+	original := New(code)
+	rng := rand.New(rand.NewSource(5))
+
+	for passes := Pass(0); passes <= AllPasses; passes++ {
+		opt := Optimize(code, passes)
+		calc := New(opt)
+		if passes == AllPasses {
+			r.Less(len(opt), len(code))
+		}
+
+		for i := 0; i < 50; i++ {
+			in := make([]int, 14)
+			for j := range in {
+				in[j] = 1 + rng.Intn(9)
+			}
+
+			want, err := original.Run(Ints(in...))
+			r.NoError(err)
+
+			got, err := calc.Run(Ints(in...))
+			r.NoError(err)
+			r.Equal(want, got, "passes %04b, input %v", passes, in)
+			r.Equal(original.reg, calc.reg, "passes %04b, input %v", passes, in)
+		}
+	}
+}
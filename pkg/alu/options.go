@@ -0,0 +1,346 @@
+package alu
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Options choose the arithmetic that an ALU uses. The zero value gives
+// 64-bit registers that wrap around on overflow, and division that
+// truncates towards zero, which is how an ALU made by New behaves on a
+// 64-bit platform.
+//
+// Optimize, AnalyzeRanges, RunSymbolic and CheckEquivalent only know about
+// the default arithmetic. In particular, an optimized program may behave
+// differently, or be rejected by NewWithOptions, with any other options.
+type Options struct {
+	Width    Width
+	Overflow Overflow
+	Division Division
+}
+
+// Width is the size of each register.
+type Width uint8
+
+const (
+	// Width64 gives 64-bit registers. It needs a platform where int has
+	// 64 bits.
+	Width64 Width = iota
+	Width32
+	Width16
+	Width8
+
+	// WidthBig gives registers of unlimited size, which never overflow.
+	// See BigRegisters.
+	WidthBig
+)
+
+// bits returns the number of bits in the width, or 0 for WidthBig.
+func (w Width) bits() uint {
+	return [...]uint{64, 32, 16, 8, 0}[w]
+}
+
+// Overflow is what happens when the result of an instruction does not fit
+// in its register. Only add, mul and div can overflow. An input value that
+// does not fit is treated in the same way.
+type Overflow uint8
+
+const (
+	// WrapOverflow keeps the low bits of the result, as Go does.
+	WrapOverflow Overflow = iota
+
+	// SaturateOverflow gives the largest or smallest value that fits,
+	// whichever is nearest to the true result.
+	SaturateOverflow
+
+	// FailOnOverflow stops the run with an error.
+	FailOnOverflow
+)
+
+// Division is the rule that div and mod use to round their results.
+// Whichever rule is used, (x div y) * y + (x mod y) == x.
+type Division uint8
+
+const (
+	// TruncatedDivision rounds the quotient towards zero, so the remainder
+	// has the same sign as the dividend. This is how Go's / and % work.
+	TruncatedDivision Division = iota
+
+	// FlooredDivision rounds the quotient down, so the remainder has the
+	// same sign as the divisor.
+	FlooredDivision
+
+	// EuclideanDivision chooses the quotient so that the remainder is
+	// never negative.
+	EuclideanDivision
+)
+
+// NewWithOptions is like New, but uses the given arithmetic. It returns an
+// error if the options are invalid, or if an immediate operand in the
+// program does not fit in a register.
+//
+// An ALU with any options other than the defaults executes one instruction
+// at a time, which is several times slower than an ALU made by New.
+func NewWithOptions(code Program, opts Options) (*ALU, error) {
+	if opts.Width > WidthBig || opts.Overflow > FailOnOverflow || opts.Division > EuclideanDivision {
+		return nil, errors.Errorf("invalid options %+v", opts)
+	}
+	if opts.Width == Width64 && strconv.IntSize != 64 {
+		return nil, errors.Errorf("64-bit registers need a 64-bit platform, not %d-bit", strconv.IntSize)
+	}
+
+	if bits := opts.Width.bits(); bits != 0 {
+		for _, inst := range code {
+			if n, ok := inst.p2.isImmediate(); ok && !inst.op.isJump() && !fits(int64(n), bits) {
+				return nil, errors.Errorf("line %d: %d does not fit in %d bits", inst.line, n, bits)
+			}
+		}
+	}
+
+	a := New(code)
+	a.opts = opts
+	a.custom = opts != Options{}
+	if opts.Width == WidthBig {
+		a.big = new([4]big.Int)
+	}
+	return a, nil
+}
+
+// fits checks if n can be held in the given number of bits.
+func fits(n int64, bits uint) bool {
+	return bits == 64 || n >= -1<<(bits-1) && n < 1<<(bits-1)
+}
+
+// errOverflow is returned when an instruction overflows with FailOnOverflow.
+func errOverflow(inst *instruction) error {
+	return errors.Errorf("execution failed on %s: integer overflow", inst.where())
+}
+
+// stepOptions is the part of step that uses the ALU's options: it executes
+// every instruction except for jmp, call and ret.
+func (a *ALU) stepOptions(inst *instruction) error {
+	if a.big != nil {
+		return a.stepBig(inst)
+	}
+
+	x := int64(a.reg[inst.r1&3])
+	y := int64(inst.p2.n)
+	if inst.p2.kind == registerOperand {
+		y = int64(a.reg[inst.p2.reg&3])
+	}
+
+	var (
+		v        int64
+		overflow bool // overflow is true if v has wrapped around 64 bits.
+		positive bool // positive is the sign of the true result, if it overflowed.
+	)
+	switch inst.op {
+	case opInput:
+		n, err := a.read(inst)
+		if err != nil {
+			return err
+		}
+		v = int64(n)
+
+	case opAdd:
+		v = x + y
+		overflow = (x > 0 && y > 0 && v < 0) || (x < 0 && y < 0 && v >= 0)
+		positive = x > 0
+
+	case opMultiply:
+		v = x * y
+		overflow = x != 0 && (v/x != y || x == -1 && y == math.MinInt64)
+		positive = (x < 0) == (y < 0)
+
+	case opDivide:
+		if y == 0 {
+			return errDivide(inst)
+		}
+		v, _ = divMod(x, y, a.opts.Division)
+		overflow, positive = x == math.MinInt64 && y == -1, true
+
+	case opModulo:
+		if y == 0 {
+			return errModulo(inst)
+		}
+		_, v = divMod(x, y, a.opts.Division)
+
+	case opEquals:
+		if x == y {
+			v = 1
+		}
+
+	case opJumpNotZero:
+		if x != 0 {
+			a.pc = inst.p2.n
+			return nil
+		}
+		a.pc++
+		return nil
+	}
+
+	bits := a.opts.Width.bits()
+	if !overflow && !fits(v, bits) {
+		// narrower registers are calculated exactly in 64 bits:
+		overflow, positive = true, v > 0
+	}
+	if overflow {
+		switch a.opts.Overflow {
+		case WrapOverflow:
+			v = v << (64 - bits) >> (64 - bits)
+		case SaturateOverflow:
+			if positive {
+				v = 1<<(bits-1) - 1
+			} else {
+				v = -1 << (bits - 1)
+			}
+		default:
+			return errOverflow(inst)
+		}
+	}
+
+	a.reg[inst.r1&3] = int(v)
+	a.pc++
+	return nil
+}
+
+// divMod divides x by y, which must not be 0, rounding with the given rule.
+// The quotient overflows for math.MinInt64 / -1, and wraps around as in Go.
+func divMod(x, y int64, rule Division) (q, r int64) {
+	q, r = x/y, x%y
+	if r == 0 {
+		return q, r
+	}
+	switch rule {
+	case FlooredDivision:
+		if (r < 0) != (y < 0) {
+			q, r = q-1, r+y
+		}
+	case EuclideanDivision:
+		if r < 0 {
+			if y > 0 {
+				q, r = q-1, r+y
+			} else {
+				q, r = q+1, r-y
+			}
+		}
+	}
+	return q, r
+}
+
+// BigRegisters holds the value of each of the ALU's registers, with no
+// limit on their size.
+type BigRegisters struct {
+	W, X, Y, Z *big.Int
+}
+
+// BigRegisters returns a copy of the current value of each register.
+// With WidthBig, the values in Registers and Snapshot, and the result of
+// Run, are clamped to fit in an int, but the values here are exact.
+func (a *ALU) BigRegisters() BigRegisters {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var reg [4]*big.Int
+	for i := range reg {
+		if a.big != nil {
+			reg[i] = new(big.Int).Set(&a.big[i])
+		} else {
+			reg[i] = big.NewInt(int64(a.reg[i]))
+		}
+	}
+	return BigRegisters{W: reg[0], X: reg[1], Y: reg[2], Z: reg[3]}
+}
+
+// stepBig is stepOptions for WidthBig.
+func (a *ALU) stepBig(inst *instruction) error {
+	r := &a.big[inst.r1&3]
+	y := new(big.Int).SetInt64(int64(inst.p2.n))
+	if inst.p2.kind == registerOperand {
+		y.Set(&a.big[inst.p2.reg&3])
+	}
+
+	switch inst.op {
+	case opInput:
+		n, err := a.read(inst)
+		if err != nil {
+			return err
+		}
+		r.SetInt64(int64(n))
+
+	case opAdd:
+		r.Add(r, y)
+
+	case opMultiply:
+		r.Mul(r, y)
+
+	case opDivide, opModulo:
+		if y.Sign() == 0 {
+			if inst.op == opDivide {
+				return errDivide(inst)
+			}
+			return errModulo(inst)
+		}
+		q, m := bigDivMod(r, y, a.opts.Division)
+		if inst.op == opDivide {
+			r.Set(q)
+		} else {
+			r.Set(m)
+		}
+
+	case opEquals:
+		if r.Cmp(y) == 0 {
+			r.SetInt64(1)
+		} else {
+			r.SetInt64(0)
+		}
+
+	case opJumpNotZero:
+		if r.Sign() != 0 {
+			a.pc = inst.p2.n
+			return nil
+		}
+		a.pc++
+		return nil
+	}
+
+	a.reg[inst.r1&3] = clamp(r)
+	a.pc++
+	return nil
+}
+
+// bigDivMod is divMod for big integers.
+func bigDivMod(x, y *big.Int, rule Division) (q, r *big.Int) {
+	q, r = new(big.Int), new(big.Int)
+	switch rule {
+	case EuclideanDivision:
+		q.DivMod(x, y, r)
+	default:
+		q.QuoRem(x, y, r)
+		if rule == FlooredDivision && r.Sign() != 0 && r.Sign() != y.Sign() {
+			q.Sub(q, big.NewInt(1))
+			r.Add(r, y)
+		}
+	}
+	return q, r
+}
+
+// fitsInt checks if n can be held in an int.
+func fitsInt(n *big.Int) bool {
+	return n.IsInt64() && fits(n.Int64(), strconv.IntSize)
+}
+
+// clamp returns the nearest int to n.
+func clamp(n *big.Int) int {
+	switch {
+	case fitsInt(n):
+		return int(n.Int64())
+	case n.Sign() > 0:
+		return math.MaxInt
+	default:
+		return math.MinInt
+	}
+}
@@ -0,0 +1,240 @@
+package alu
+
+import (
+	"math"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	const (
+		maxInt8  = "add z 127\nadd z 1\n"
+		maxInt64 = "add z 9223372036854775807\nadd z 1\n"
+		minInt8  = "add z -128\nadd x -1\ndiv z x\n"
+	)
+
+	tt := []struct {
+		name    string
+		program string
+		opts    Options
+		input   []int
+		want    int
+		wantErr string
+	}{
+		{
+			name:    "8 bits wrap",
+			program: maxInt8,
+			opts:    Options{Width: Width8},
+			want:    -128,
+		},
+		{
+			name:    "8 bits saturate",
+			program: maxInt8,
+			opts:    Options{Width: Width8, Overflow: SaturateOverflow},
+			want:    127,
+		},
+		{
+			name:    "8 bits fail",
+			program: maxInt8,
+			opts:    Options{Width: Width8, Overflow: FailOnOverflow},
+			wantErr: "execution failed on line 2: integer overflow",
+		},
+		{
+			name:    "16 bits wrap a product",
+			program: "add z 300\nmul z 300\n",
+			opts:    Options{Width: Width16},
+			want:    90000 - 65536,
+		},
+		{
+			name:    "32 bits wrap",
+			program: "add z 2147483647\nadd z 1\n",
+			opts:    Options{Width: Width32},
+			want:    math.MinInt32,
+		},
+		{
+			name:    "64 bits wrap",
+			program: maxInt64,
+			opts:    Options{Division: FlooredDivision},
+			want:    math.MinInt64,
+		},
+		{
+			name:    "64 bits saturate",
+			program: maxInt64,
+			opts:    Options{Overflow: SaturateOverflow},
+			want:    math.MaxInt64,
+		},
+		{
+			name:    "64 bits saturate a negative product",
+			program: "add z -4611686018427387904\nmul z 4\n",
+			opts:    Options{Overflow: SaturateOverflow},
+			want:    math.MinInt64,
+		},
+		{
+			name:    "64 bits fail",
+			program: "add z 4611686018427387904\nmul z -4\n",
+			opts:    Options{Overflow: FailOnOverflow},
+			wantErr: "execution failed on line 2: integer overflow",
+		},
+		{
+			name:    "dividing the smallest value by -1 wraps",
+			program: minInt8,
+			opts:    Options{Width: Width8},
+			want:    -128,
+		},
+		{
+			name:    "dividing the smallest value by -1 saturates",
+			program: minInt8,
+			opts:    Options{Width: Width8, Overflow: SaturateOverflow},
+			want:    127,
+		},
+		{
+			name:    "an input that is too large wraps",
+			program: "inp z\n",
+			opts:    Options{Width: Width8},
+			input:   []int{200},
+			want:    -56,
+		},
+		{
+			name:    "an input that is too large fails",
+			program: "inp z\n",
+			opts:    Options{Width: Width8, Overflow: FailOnOverflow},
+			input:   []int{200},
+			wantErr: "execution failed on line 1: integer overflow",
+		},
+		{
+			name:    "division by 0 still fails",
+			program: "mod z x\n",
+			opts:    Options{Width: Width16},
+			wantErr: "execution failed on line 1: modulo of 0 is undefined",
+		},
+		{
+			name:    "an immediate that is too large",
+			program: "add z 200\n",
+			opts:    Options{Width: Width8},
+			wantErr: "line 1: 200 does not fit in 8 bits",
+		},
+		{
+			name:    "invalid options",
+			program: "add z 1\n",
+			opts:    Options{Division: 7},
+			wantErr: "invalid options {Width:0 Overflow:0 Division:7}",
+		},
+		{
+			name:    "arbitrary precision",
+			program: "add z 9223372036854775807\nmul z 4\ndiv z 8\n",
+			opts:    Options{Width: WidthBig},
+			want:    4611686018427387903,
+		},
+		{
+			name:    "arbitrary precision with a result that is too large",
+			program: "add z 9223372036854775807\nmul z z\n",
+			opts:    Options{Width: WidthBig},
+			wantErr: "the result is too large for an int; see BigRegisters",
+		},
+		{
+			name:    "arbitrary precision with control flow",
+			program: "add x 3\nloop: mul z 10\nadd z 1\nadd x -1\njnz x loop\n",
+			opts:    Options{Width: WidthBig},
+			want:    111,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			calc, err := NewWithOptions(code, tc.opts)
+			if err == nil {
+				var got int
+				got, err = calc.Run(Ints(tc.input...))
+				if tc.wantErr == "" {
+					r.NoError(err)
+					r.Equal(tc.want, got)
+					return
+				}
+			}
+			r.EqualError(err, tc.wantErr)
+		})
+	}
+}
+
+func TestNewWithOptions_division(t *testing.T) {
+	tt := []struct {
+		x, y     int
+		rule     Division
+		div, mod int
+	}{
+		{-7, 2, TruncatedDivision, -3, -1},
+		{-7, 2, FlooredDivision, -4, 1},
+		{-7, 2, EuclideanDivision, -4, 1},
+		{7, -2, TruncatedDivision, -3, 1},
+		{7, -2, FlooredDivision, -4, -1},
+		{7, -2, EuclideanDivision, -3, 1},
+		{-7, -2, TruncatedDivision, 3, -1},
+		{-7, -2, FlooredDivision, 3, -1},
+		{-7, -2, EuclideanDivision, 4, 1},
+		{6, -2, FlooredDivision, -3, 0},
+	}
+
+	code, err := Compile([]byte("inp x\ninp y\nadd w x\ndiv w y\nadd z x\nmod z y\n"))
+	require.NoError(t, err)
+
+	for _, tc := range tt {
+		for _, width := range []Width{Width64, Width8, WidthBig} {
+			calc, err := NewWithOptions(code, Options{Width: width, Division: tc.rule})
+			require.NoError(t, err)
+
+			_, err = calc.Run(Ints(tc.x, tc.y))
+			require.NoError(t, err)
+
+			reg := calc.BigRegisters()
+			assert.Equal(t, big.NewInt(int64(tc.div)), reg.W, "%+v width %d", tc, width)
+			assert.Equal(t, big.NewInt(int64(tc.mod)), reg.Z, "%+v width %d", tc, width)
+		}
+	}
+}
+
+func TestNewWithOptions_day24(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+	code, err := Compile(src)
+	r.NoError(err)
+
+	want, err := New(code).Run(Digits("13579246899999"))
+	r.NoError(err)
+
+	// the day 24 program never overflows 64 bits, nor divides negative numbers:
+	for _, opts := range []Options{
+		{},
+		{Overflow: FailOnOverflow},
+		{Width: WidthBig, Division: EuclideanDivision},
+	} {
+		calc, err := NewWithOptions(code, opts)
+		r.NoError(err)
+		got, err := calc.Run(Digits("13579246899999"))
+		r.NoError(err, "%+v", opts)
+		r.Equal(want, got, "%+v", opts)
+	}
+}
+
+func TestRestore_width(t *testing.T) {
+	code, err := Compile([]byte("inp z\n"))
+	require.NoError(t, err)
+
+	calc, err := NewWithOptions(code, Options{Width: Width8})
+	require.NoError(t, err)
+
+	err = calc.Restore(Snapshot{Registers: Registers{X: 300}})
+	assert.EqualError(t, err, "register x holds 300, which does not fit in 8 bits")
+}
@@ -0,0 +1,167 @@
+package alu
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Pool runs one program with many different inputs, in parallel.
+// A Pool is safe for concurrent use, and each call to Run or RunOrdered
+// starts its own set of goroutines.
+type Pool struct {
+	code    Program
+	workers int
+}
+
+// Result is the outcome of running a program with one input.
+type Result struct {
+	Index     int // Index is the position of the input in the stream, from 0.
+	Z         int // Z is the value returned by Run.
+	Registers Registers
+	Err       error // Err is the error returned by Run, if any.
+}
+
+// NewPool prepares to run the given program on the given number of
+// goroutines. If workers is 0 or less, it uses one per CPU.
+func NewPool(code Program, workers int) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &Pool{code: fuse(code), workers: workers}
+}
+
+// job is a single input, numbered by its position in the stream.
+type job struct {
+	index int
+	in    Input
+}
+
+// Run executes the program once for each input received from inputs, and
+// sends each result as soon as it is ready, so the results may arrive in any
+// order. The results channel is closed once inputs is closed and every
+// result has been sent, or as soon as the context is cancelled.
+func (p *Pool) Run(ctx context.Context, inputs <-chan Input) <-chan Result {
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			select {
+			case in, ok := <-inputs:
+				if !ok {
+					return
+				}
+				select {
+				case jobs <- job{index: i, in: in}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make(chan Result, p.workers)
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			calc := &ALU{code: p.code}
+			for j := range jobs {
+				z, err := calc.RunContext(ctx, j.in)
+				res := Result{Index: j.index, Z: z, Registers: registers(calc.reg), Err: err}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// RunOrdered is the same as Run, except that it sends the results in the
+// same order as the inputs. Results that are ready early are held until
+// the results before them have been sent.
+func (p *Pool) RunOrdered(ctx context.Context, inputs <-chan Input) <-chan Result {
+	unordered := p.Run(ctx, inputs)
+	results := make(chan Result, p.workers)
+
+	go func() {
+		defer close(results)
+		pending := make(map[int]Result)
+		next := 0
+		for res := range unordered {
+			pending[res.Index] = res
+			for {
+				res, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return results
+}
+
+// RunMany executes the program once for each of the inputs, using the given
+// number of goroutines (or one per CPU, if workers is 0), and returns the
+// results in the same order as the inputs. If the context is cancelled, the
+// inputs that did not run have the context's error as their result.
+func RunMany(ctx context.Context, code Program, inputs []Input, workers int) []Result {
+	return RunManyWithProgress(ctx, code, inputs, workers, nil)
+}
+
+// RunManyWithProgress is like RunMany, but reports its progress through a
+// long batch of runs. After each run finishes, it calls progress with the
+// number of runs that have finished so far, and the total number of inputs.
+// The calls are made one at a time, from the goroutine that called
+// RunManyWithProgress. If progress is nil, it is not called.
+func RunManyWithProgress(ctx context.Context, code Program, inputs []Input, workers int,
+	progress func(done, total int)) []Result {
+	stream := make(chan Input)
+	go func() {
+		defer close(stream)
+		for _, in := range inputs {
+			select {
+			case stream <- in:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make([]Result, len(inputs))
+	done := make([]bool, len(inputs))
+	finished := 0
+	for res := range NewPool(code, workers).Run(ctx, stream) {
+		results[res.Index] = res
+		done[res.Index] = true
+		finished++
+		if progress != nil {
+			progress(finished, len(inputs))
+		}
+	}
+
+	for i := range results {
+		if !done[i] {
+			results[i] = Result{Index: i, Z: 1, Err: ctx.Err()}
+		}
+	}
+	return results
+}
@@ -0,0 +1,126 @@
+package alu
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolInputs makes n random inputs for the day 24 program, along with the
+// expected result of each one. Every tenth input is too short, so that it
+// fails.
+func poolInputs(t *testing.T, n int) (Program, []string, []Result) {
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	require.NoError(t, err)
+	code, err := Compile(src)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(10))
+	calc := New(code)
+	digits := make([]string, n)
+	want := make([]Result, n)
+	for i := range digits {
+		length := 14
+		if i%10 == 9 {
+			length = 13
+		}
+		for j := 0; j < length; j++ {
+			digits[i] += strconv.Itoa(1 + rng.Intn(9))
+		}
+
+		z, err := calc.Run(Digits(digits[i]))
+		want[i] = Result{Index: i, Z: z, Registers: registers(calc.reg), Err: err}
+	}
+	return code, digits, want
+}
+
+func TestPool(t *testing.T) {
+	code, digits, want := poolInputs(t, 200)
+	pool := NewPool(code, 4)
+
+	stream := func() <-chan Input {
+		ch := make(chan Input)
+		go func() {
+			defer close(ch)
+			for _, d := range digits {
+				ch <- Digits(d)
+			}
+		}()
+		return ch
+	}
+
+	t.Run("as they complete", func(t *testing.T) {
+		got := make([]Result, len(digits))
+		count := 0
+		for res := range pool.Run(context.Background(), stream()) {
+			got[res.Index] = res
+			count++
+		}
+		assert.Equal(t, len(digits), count)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("in order", func(t *testing.T) {
+		var got []Result
+		for res := range pool.RunOrdered(context.Background(), stream()) {
+			got = append(got, res)
+		}
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestRunMany(t *testing.T) {
+	code, digits, want := poolInputs(t, 100)
+	inputs := make([]Input, len(digits))
+	for i, d := range digits {
+		inputs[i] = Digits(d)
+	}
+
+	got := RunMany(context.Background(), code, inputs, 0)
+	require.Equal(t, want, got)
+
+	var eoi *EndOfInputError
+	assert.True(t, errors.As(got[9].Err, &eoi))
+	assert.NoError(t, got[10].Err)
+}
+
+func TestRunManyWithProgress(t *testing.T) {
+	code, digits, want := poolInputs(t, 50)
+	inputs := make([]Input, len(digits))
+	for i, d := range digits {
+		inputs[i] = Digits(d)
+	}
+
+	var calls [][2]int
+	got := RunManyWithProgress(context.Background(), code, inputs, 4, func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	})
+	require.Equal(t, want, got)
+
+	require.Len(t, calls, len(inputs))
+	for i, call := range calls {
+		assert.Equal(t, [2]int{i + 1, len(inputs)}, call)
+	}
+}
+
+func TestRunMany_cancelled(t *testing.T) {
+	code, digits, _ := poolInputs(t, 20)
+	inputs := make([]Input, len(digits))
+	for i, d := range digits {
+		inputs[i] = Digits(d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i, res := range RunMany(ctx, code, inputs, 2) {
+		assert.Equal(t, i, res.Index)
+		assert.ErrorIs(t, res.Err, context.Canceled)
+	}
+}
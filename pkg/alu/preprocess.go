@@ -0,0 +1,438 @@
+package alu
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+)
+
+// CompileFS compiles the named file from fsys, along with any files that it
+// includes. It accepts the same source as Compile, which may also use these
+// directives, each on a line of its own:
+//
+//	const NAME value
+//
+// defines a constant, which can be used anywhere that a number can. The
+// value is a number, or the name of another constant.
+//
+//	macro NAME param1 param2 ...
+//	...
+//	endm
+//
+// defines a macro. A line that uses the macro in place of an opcode, as in
+// 'NAME arg1 arg2 ...', is replaced by the lines between macro and endm, with
+// each parameter replaced by its argument. Each argument is a single
+// register, number or label. Labels that are defined inside a macro are
+// local to each use of it.
+//
+//	include "path"
+//
+// compiles another file in place of the directive, so that it can define
+// constants and macros for the rest of the program. The path is relative to
+// the directory of the file that includes it.
+//
+// Syntax errors give the file and line where each problem is, which is
+// inside the macro for the code from a macro. Otherwise, the code from a
+// macro has the file and line where the macro was used, so that is where
+// run-time errors point. The '%+v' disassembly shows the file and line of
+// each instruction, and which line of which macro it came from.
+func CompileFS(fsys fs.FS, name string) (Program, error) {
+	src, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	lex := newLexer(src)
+	lex.info = &srcInfo{file: name}
+	return compile(newPreprocessor(fsys, lex))
+}
+
+// maxNesting is the deepest that macros can be used inside other macros,
+// or that files can be included. It stops recursive macros and includes.
+const maxNesting = 64
+
+// preprocessor reads tokens from a lexer, and carries out the directives
+// that define constants and macros and include other files, so that the
+// parser only sees plain instructions.
+type preprocessor struct {
+	fsys    fs.FS
+	files   []*lexer // files is a stack of the files being read.
+	pending []token  // pending holds the tokens that are ready for the parser.
+	consts  map[string]constDef
+	macros  map[string]*macro
+	uses    int            // uses counts the uses of every macro, to name local labels.
+	order   map[string]int // order holds the place of each file, as first read.
+	errs    *ErrorList
+}
+
+// constDef is the definition of a constant.
+type constDef struct {
+	name  token
+	value string
+}
+
+// macro is the definition of a macro.
+type macro struct {
+	name   token
+	params []string
+	body   [][]token       // body holds each line, including its newline.
+	labels map[string]bool // labels holds each label defined in the body.
+}
+
+func newPreprocessor(fsys fs.FS, lex *lexer) *preprocessor {
+	p := &preprocessor{
+		fsys:   fsys,
+		files:  []*lexer{lex},
+		consts: make(map[string]constDef),
+		macros: make(map[string]*macro),
+		order:  make(map[string]int),
+		errs:   new(ErrorList),
+	}
+	if lex.info != nil {
+		p.order[lex.info.file] = 0
+	}
+	return p
+}
+
+// next returns the next token for the parser.
+func (p *preprocessor) next() token {
+	for len(p.pending) == 0 {
+		line := p.readLine()
+		end := &line[len(line)-1]
+		if end.kind == tokEOF && len(p.files) > 1 {
+			// the end of an included file just ends its last line:
+			p.files = p.files[:len(p.files)-1]
+			end.kind, end.text = tokNewline, "\n"
+		}
+		p.process(line, 0)
+	}
+
+	tok := p.pending[0]
+	p.pending = p.pending[1:]
+	return tok
+}
+
+// readLine reads the tokens of the next line from the current file,
+// ending with a newline or the end of the file.
+func (p *preprocessor) readLine() []token {
+	lex := p.files[len(p.files)-1]
+	var line []token
+	for {
+		tok := lex.next()
+		line = append(line, tok)
+		if tok.kind == tokNewline || tok.kind == tokEOF {
+			return line
+		}
+	}
+}
+
+// isDirective checks if a line starts with the given directive.
+func isDirective(line []token, name string) bool {
+	return line[0].kind == tokIdent && line[0].text == name && line[1].kind != tokColon
+}
+
+// directives lists the name of every directive.
+var directives = []string{"const", "macro", "endm", "include"}
+
+// process carries out the directive on the given line, or expands the
+// macro that it uses, or else passes it on to the parser unchanged.
+// Depth is the number of macros being expanded.
+func (p *preprocessor) process(line []token, depth int) {
+	end := line[len(line)-1]
+	switch {
+	case isDirective(line, "const"):
+		p.defineConst(line)
+		p.pending = append(p.pending, end)
+		return
+	case isDirective(line, "macro"):
+		p.defineMacro(line)
+		return
+	case isDirective(line, "endm"):
+		p.errs.add(line[0], "endm without macro")
+		p.pending = append(p.pending, end)
+		return
+	case isDirective(line, "include"):
+		p.include(line)
+		p.pending = append(p.pending, end)
+		return
+	}
+
+	// a macro can be used in place of an opcode, after any labels:
+	i := 0
+	for line[i].kind == tokIdent && line[i+1].kind == tokColon {
+		i += 2
+	}
+	if m, ok := p.macros[line[i].text]; ok && line[i].kind == tokIdent {
+		// the arguments are replaced along with the rest of the body:
+		p.expand(m, line, i, depth)
+		return
+	}
+
+	p.substitute(line, i)
+	p.pending = append(p.pending, line...)
+}
+
+// substitute replaces each constant in the operands of the instruction
+// whose opcode is line[op] with its value. The target of a jump is always
+// a label, so it is left alone.
+func (p *preprocessor) substitute(line []token, op int) {
+	target := -1
+	if code, ok := parseOpcode(line[op].text); ok && code.isJump() {
+		target = op + 1
+		if code.hasR1() {
+			target++
+		}
+	}
+
+	for i := op + 1; i < len(line); i++ {
+		tok := line[i]
+		if def, ok := p.consts[tok.text]; ok && tok.kind == tokIdent && i != target {
+			line[i].kind, line[i].text = tokNumber, def.value
+		}
+	}
+}
+
+// checkName checks that a new constant or macro can have the given name.
+func (p *preprocessor) checkName(tok token, what string) bool {
+	if tok.kind != tokIdent {
+		p.errs.add(tok, "expected %s name, found %s", what, describe(tok))
+		return false
+	}
+	if p.reserved(tok.text) {
+		p.errs.add(tok, "%q is reserved, and cannot be the name of a %s", tok.text, what)
+		return false
+	}
+	if def, ok := p.consts[tok.text]; ok {
+		p.errs.add(tok, "%q is already defined on %s", tok.text, def.name.src.position(def.name.line))
+		return false
+	}
+	if m, ok := p.macros[tok.text]; ok {
+		p.errs.add(tok, "%q is already defined on %s", tok.text, m.name.src.position(m.name.line))
+		return false
+	}
+	return true
+}
+
+// reserved checks if the name is used by an opcode, register or directive.
+func (p *preprocessor) reserved(name string) bool {
+	if _, ok := parseOpcode(name); ok {
+		return true
+	}
+	if _, err := parseR1(name); err == nil {
+		return true
+	}
+	for _, d := range directives {
+		if name == d {
+			return true
+		}
+	}
+	return false
+}
+
+// defineConst carries out 'const NAME value'.
+func (p *preprocessor) defineConst(line []token) {
+	if len(line) != 4 {
+		p.errs.add(line[0], "const needs a name and a value")
+		return
+	}
+	name, val := line[1], line[2]
+	if !p.checkName(name, "constant") {
+		return
+	}
+
+	switch val.kind {
+	case tokNumber:
+		if _, err := strconv.Atoi(val.text); err != nil {
+			p.errs.add(val, "%q is out of range", val.text)
+			return
+		}
+		p.consts[name.text] = constDef{name: name, value: val.text}
+
+	case tokIdent:
+		def, ok := p.consts[val.text]
+		if !ok {
+			p.errs.add(val, "undefined constant %q", val.text)
+			return
+		}
+		p.consts[name.text] = constDef{name: name, value: def.value}
+
+	default:
+		p.errs.add(val, "expected number or constant, found %s", describe(val))
+	}
+}
+
+// defineMacro carries out 'macro NAME params...', reading the body of the
+// macro up to its endm.
+func (p *preprocessor) defineMacro(line []token) {
+	m := &macro{name: line[1], labels: make(map[string]bool)}
+	ok := p.checkName(m.name, "macro")
+
+	var paramToks []token
+	if len(line) > 3 {
+		paramToks = line[2 : len(line)-1]
+	}
+	params := make(map[string]bool)
+	for _, tok := range paramToks {
+		switch {
+		case tok.kind != tokIdent:
+			p.errs.add(tok, "expected parameter name, found %s", describe(tok))
+		case p.reserved(tok.text):
+			p.errs.add(tok, "%q is reserved, and cannot be the name of a parameter", tok.text)
+		case params[tok.text]:
+			p.errs.add(tok, "duplicate parameter %q", tok.text)
+		default:
+			params[tok.text] = true
+			m.params = append(m.params, tok.text)
+		}
+	}
+
+	for {
+		body := p.readLine()
+		end := body[len(body)-1]
+		if isDirective(body, "endm") {
+			if len(body) > 2 {
+				p.errs.add(body[1], "unexpected %s after endm", describe(body[1]))
+			}
+			break
+		}
+		if end.kind == tokEOF {
+			// the lexer keeps returning EOF, so next will see it again
+			p.errs.add(line[0], "macro has no endm")
+			return
+		}
+
+		nested := false
+		for _, d := range directives {
+			if isDirective(body, d) {
+				p.errs.add(body[0], "%s is not allowed inside a macro", d)
+				nested = true
+			}
+		}
+		if nested {
+			continue
+		}
+
+		for i := 0; body[i].kind == tokIdent && body[i+1].kind == tokColon; i += 2 {
+			m.labels[body[i].text] = true
+		}
+		m.body = append(m.body, body)
+	}
+
+	if ok {
+		p.macros[m.name.text] = m
+	}
+}
+
+// expand replaces a line that uses the macro with the macro's body. The
+// macro's name is line[call], and any labels before it name the first
+// instruction of the body.
+func (p *preprocessor) expand(m *macro, line []token, call, depth int) {
+	labels, name, args, end := line[:call], line[call], line[call+1:len(line)-1], line[len(line)-1]
+
+	if depth == maxNesting {
+		p.errs.add(name, "macro %q is nested too deeply", name.text)
+		p.pending = append(p.pending, end)
+		return
+	}
+	if len(args) != len(m.params) {
+		p.errs.add(name, "macro %q needs %d arguments, found %d", name.text, len(m.params), len(args))
+		p.pending = append(p.pending, end)
+		return
+	}
+	for _, arg := range args {
+		if arg.kind != tokIdent && arg.kind != tokNumber {
+			p.errs.add(arg, "expected register, number or label, found %s", describe(arg))
+			p.pending = append(p.pending, end)
+			return
+		}
+	}
+
+	p.uses++
+	callFile, callLine := "", name.line
+	if name.src != nil {
+		callFile = name.src.file
+		if name.src.expansion != "" {
+			// a macro used inside another one has the outer macro's call:
+			callFile, callLine = name.src.callFile, name.src.callLine
+		}
+	}
+
+	for i, body := range m.body {
+		info := &srcInfo{
+			expansion: fmt.Sprintf("%s in macro %s", m.name.src.position(body[0].line), m.name.text),
+			callFile:  callFile,
+			callLine:  callLine,
+		}
+		if m.name.src != nil {
+			info.file = m.name.src.file
+		}
+
+		out := make([]token, 0, len(labels)+len(body))
+		if i == 0 {
+			out = append(out, labels...)
+		}
+		for _, tok := range body {
+			tok.src = info
+			if tok.kind == tokIdent {
+				if k := indexOf(m.params, tok.text); k >= 0 {
+					tok = args[k]
+				} else if m.labels[tok.text] {
+					tok.text = fmt.Sprintf("%s__%d", tok.text, p.uses)
+				}
+			}
+			out = append(out, tok)
+		}
+		p.process(out, depth+1)
+	}
+
+	if len(m.body) == 0 {
+		p.pending = append(p.pending, labels...)
+	}
+	p.pending = append(p.pending, end)
+}
+
+// indexOf returns the index of s in list, or -1.
+func indexOf(list []string, s string) int {
+	for i, t := range list {
+		if t == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// include carries out 'include "path"', by reading from the named file
+// until it ends.
+func (p *preprocessor) include(line []token) {
+	if len(line) != 3 || line[1].kind != tokString {
+		p.errs.add(line[0], "include needs a quoted file name")
+		return
+	}
+	tok := line[1]
+	if p.fsys == nil {
+		p.errs.add(tok, "include needs a file system; see CompileFS")
+		return
+	}
+	if len(p.files) == maxNesting {
+		p.errs.add(tok, "includes are nested too deeply")
+		return
+	}
+
+	dir := "."
+	if info := p.files[len(p.files)-1].info; info != nil {
+		dir = path.Dir(info.file)
+	}
+	name := path.Join(dir, tok.text[1:len(tok.text)-1])
+
+	src, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		p.errs.add(tok, "cannot include %q: %v", name, err)
+		return
+	}
+	lex := newLexer(src)
+	lex.info = &srcInfo{file: name}
+	p.files = append(p.files, lex)
+	if _, ok := p.order[name]; !ok {
+		p.order[name] = len(p.order)
+	}
+}
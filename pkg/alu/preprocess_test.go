@@ -0,0 +1,255 @@
+package alu
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileFS(t *testing.T) {
+	tt := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "constants",
+			files: map[string]string{
+				"main.alu": "const BASE 26\nconst RADIX BASE\nmul z RADIX\ndiv z BASE\n",
+			},
+			want: "mul z 26\ndiv z 26\n",
+		},
+		{
+			name: "constants are not used as jump targets",
+			files: map[string]string{
+				"main.alu": "const loop 3\nloop: add x loop\njnz x loop\njmp loop\n",
+			},
+			want: "loop: add x 3\njnz x loop\njmp loop\n",
+		},
+		{
+			name: "constants as the arguments of a macro",
+			files: map[string]string{
+				"main.alu": "const N 26\nmacro push r n\nmul z n\nadd z r\nendm\npush w N\n",
+			},
+			want: "mul z 26\nadd z w\n",
+		},
+		{
+			name: "a macro with parameters",
+			files: map[string]string{
+				"main.alu": "macro push r n\nmul z n\nadd z r\nendm\ninp w\npush w 26\n",
+			},
+			want: "inp w\nmul z 26\nadd z w\n",
+		},
+		{
+			name: "labels inside a macro are local to each use",
+			files: map[string]string{
+				"main.alu": "macro countdown r\nloop: add r -1\njnz r loop\nendm\n" +
+					"add x 2\ncountdown x\nadd y 3\nstart: countdown y\njnz x start\n",
+			},
+			want: "add x 2\nloop__1: add x -1\njnz x loop__1\n" +
+				"add y 3\nloop__2: start: add y -1\njnz y loop__2\njnz x start\n",
+		},
+		{
+			name: "macros that use other macros",
+			files: map[string]string{
+				"main.alu": "macro double r\nadd r r\nendm\n" +
+					"macro quadruple r\ndouble r\ndouble r\nendm\n" +
+					"quadruple z\n",
+			},
+			want: "add z z\nadd z z\n",
+		},
+		{
+			name: "includes",
+			files: map[string]string{
+				"main.alu":     "include \"lib/defs.alu\"\ninp w\nclear z\nadd z BASE\n",
+				"lib/defs.alu": "include \"base.alu\"\nmacro clear r\nmul r 0\nendm",
+				"lib/base.alu": "const BASE 26\n",
+			},
+			want: "inp w\nmul z 0\nadd z 26\n",
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			fsys := make(fstest.MapFS)
+			for name, src := range tc.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(src)}
+			}
+
+			got, err := CompileFS(fsys, "main.alu")
+			r.NoError(err)
+
+			r.Equal(tc.want, fmt.Sprintf("%v", got))
+		})
+	}
+}
+
+func TestCompileFS_errors(t *testing.T) {
+	tt := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "an error inside a macro",
+			files: map[string]string{
+				"main.alu": "macro bad r\nadd r\nendm\ninp w\nbad w\n",
+			},
+			want: []string{"main.alu: line 2, col 6: expected register or number, found end of line"},
+		},
+		{
+			name: "a jump with trailing input inside a macro",
+			files: map[string]string{
+				"main.alu": "macro m a\njmp a extra\nendm\nm foo\nfoo:\n",
+			},
+			want: []string{`main.alu: line 2, col 7: unexpected identifier "extra" after jmp instruction`},
+		},
+		{
+			name: "an error inside an included file",
+			files: map[string]string{
+				"main.alu": "inp w\ninclude \"lib.alu\"\nadd w 1\n",
+				"lib.alu":  "add w\n",
+			},
+			want: []string{"lib.alu: line 1, col 6: expected register or number, found end of line"},
+		},
+		{
+			name: "errors are in the order that the files were included",
+			files: map[string]string{
+				"main.alu": "include \"z.alu\"\ninclude \"a.alu\"\nadd w\n",
+				"z.alu":    "add x\n",
+				"a.alu":    "add y\n",
+			},
+			want: []string{
+				"main.alu: line 3, col 6: expected register or number, found end of line",
+				"z.alu: line 1, col 6: expected register or number, found end of line",
+				"a.alu: line 1, col 6: expected register or number, found end of line",
+			},
+		},
+		{
+			name: "a missing file",
+			files: map[string]string{
+				"main.alu": "include \"lib.alu\"\n",
+			},
+			want: []string{`main.alu: line 1, col 9: cannot include "lib.alu": open lib.alu: file does not exist`},
+		},
+		{
+			name: "bad definitions",
+			files: map[string]string{
+				"main.alu": "const x 1\nconst N 1\nconst N 2\nconst M Q\nmacro add\nendm\nmacro m a a\nendm\n",
+			},
+			want: []string{
+				`main.alu: line 1, col 7: "x" is reserved, and cannot be the name of a constant`,
+				`main.alu: line 3, col 7: "N" is already defined on main.alu:2`,
+				`main.alu: line 4, col 9: undefined constant "Q"`,
+				`main.alu: line 5, col 7: "add" is reserved, and cannot be the name of a macro`,
+				`main.alu: line 7, col 11: duplicate parameter "a"`,
+			},
+		},
+		{
+			name: "a recursive macro",
+			files: map[string]string{
+				"main.alu": "macro forever\nforever\nendm\nforever\n",
+			},
+			want: []string{`main.alu: line 2, col 1: macro "forever" is nested too deeply`},
+		},
+		{
+			name: "the wrong number of arguments",
+			files: map[string]string{
+				"main.alu": "macro m r\nadd r 1\nendm\nm x y\n",
+			},
+			want: []string{`main.alu: line 4, col 1: macro "m" needs 1 arguments, found 2`},
+		},
+		{
+			name: "unbalanced macros",
+			files: map[string]string{
+				"main.alu": "endm\nmacro m\ninclude \"lib.alu\"\n",
+			},
+			want: []string{
+				"main.alu: line 1, col 1: endm without macro",
+				"main.alu: line 2, col 1: macro has no endm",
+				"main.alu: line 3, col 1: include is not allowed inside a macro",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			fsys := make(fstest.MapFS)
+			for name, src := range tc.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(src)}
+			}
+
+			_, err := CompileFS(fsys, "main.alu")
+			r.Error(err)
+
+			list, ok := err.(ErrorList)
+			r.True(ok, "%T", err)
+			var got []string
+			for _, e := range list {
+				got = append(got, e.Error())
+			}
+			r.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestCompile_include(t *testing.T) {
+	_, err := Compile([]byte("include \"lib.alu\"\n"))
+	assert.EqualError(t, err, "line 1, col 9: include needs a file system; see CompileFS")
+}
+
+func TestCompileFS_disassembly(t *testing.T) {
+	r := require.New(t)
+
+	fsys := fstest.MapFS{
+		"main.alu": {Data: []byte("include \"lib.alu\"\ninp w\npush w\ntwice w\nadd z 1\n")},
+		"lib.alu":  {Data: []byte("macro push r\nmul z 26\nadd z r\nendm\nmacro twice r\npush r\npush r\nendm\n")},
+	}
+	code, err := CompileFS(fsys, "main.alu")
+	r.NoError(err)
+
+	want := "main.alu:2  inp w\n" +
+		"main.alu:3  mul z 26  # from lib.alu:2 in macro push\n" +
+		"main.alu:3  add z w  # from lib.alu:3 in macro push\n" +
+		"main.alu:4  mul z 26  # from lib.alu:2 in macro push\n" +
+		"main.alu:4  add z w  # from lib.alu:3 in macro push\n" +
+		"main.alu:4  mul z 26  # from lib.alu:2 in macro push\n" +
+		"main.alu:4  add z w  # from lib.alu:3 in macro push\n" +
+		"main.alu:5  add z 1\n"
+	r.Equal(want, fmt.Sprintf("%+v", code))
+
+	// the code from each macro stays where the macro was used:
+	text, err := code.MarshalText()
+	r.NoError(err)
+	r.Equal("\ninp w\nmul z 26\nadd z w\nmul z 26\nadd z w\nmul z 26\nadd z w\nadd z 1\n", string(text))
+}
+
+// TestCompileFS_runtimeError checks that an error from the code in a macro
+// gives the place where the macro was used.
+func TestCompileFS_runtimeError(t *testing.T) {
+	r := require.New(t)
+
+	fsys := fstest.MapFS{
+		"main.alu": {Data: []byte("include \"lib.alu\"\ninp w\nadd w 2\nsafe w\nmodulo w x\n")},
+		"lib.alu":  {Data: []byte("macro safe r\ndiv r 1\nendm\nmacro modulo r s\nsafe r\nmod r s\nendm\n")},
+	}
+	code, err := CompileFS(fsys, "main.alu")
+	r.NoError(err)
+
+	_, err = New(code).Run(Ints(3))
+	r.EqualError(err, "execution failed on main.alu:5: modulo of 0 is undefined")
+
+	_, err = New(code).Run(Ints())
+	r.EqualError(err, "execution failed on main.alu:2: input requires an input value")
+}
@@ -0,0 +1,321 @@
+package alu
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Interval is the range of integers from Lo to Hi, inclusive.
+type Interval struct {
+	Lo, Hi int
+}
+
+// fullInterval holds every int.
+var fullInterval = Interval{math.MinInt, math.MaxInt}
+
+// Contains checks if n is in the interval.
+func (i Interval) Contains(n int) bool {
+	return i.Lo <= n && n <= i.Hi
+}
+
+// String implements fmt.Stringer.
+func (i Interval) String() string {
+	return fmt.Sprintf("[%d, %d]", i.Lo, i.Hi)
+}
+
+// union returns the smallest interval that holds both i and j.
+func (i Interval) union(j Interval) Interval {
+	if j.Lo < i.Lo {
+		i.Lo = j.Lo
+	}
+	if j.Hi > i.Hi {
+		i.Hi = j.Hi
+	}
+	return i
+}
+
+// nonZero removes 0 from the interval, if it is at either end, and returns
+// false if nothing is left.
+func (i Interval) nonZero() (Interval, bool) {
+	if i.Lo == 0 {
+		i.Lo = 1
+	}
+	if i.Hi == 0 {
+		i.Hi = -1
+	}
+	return i, i.Lo <= i.Hi
+}
+
+// RegisterRanges holds an interval for each of the ALU's registers.
+type RegisterRanges struct {
+	W, X, Y, Z Interval
+}
+
+func registerRanges(reg [4]Interval) RegisterRanges {
+	return RegisterRanges{W: reg[0], X: reg[1], Y: reg[2], Z: reg[3]}
+}
+
+// DivisionSafety is what range analysis can tell about a div or mod
+// instruction whose divisor is a register.
+type DivisionSafety int
+
+const (
+	// DivisionSafe means the divisor can never be 0.
+	DivisionSafe DivisionSafety = iota
+
+	// DivisionMayFail means the divisor might be 0.
+	DivisionMayFail
+
+	// DivisionFails means the divisor is always 0, so the instruction
+	// fails whenever it runs.
+	DivisionFails
+)
+
+var divisionSafetyNames = [...]string{
+	DivisionSafe:    "safe",
+	DivisionMayFail: "may fail",
+	DivisionFails:   "always fails",
+}
+
+// String implements fmt.Stringer.
+func (s DivisionSafety) String() string {
+	return divisionSafetyNames[s]
+}
+
+// DivisionCheck is the result of checking one reachable div or mod
+// instruction whose divisor is a register.
+type DivisionCheck struct {
+	Line        int
+	Instruction string
+	Divisor     Interval // Divisor is the range of the divisor's register.
+	Safety      DivisionSafety
+}
+
+// RangeReport is the result of AnalyzeRanges.
+type RangeReport struct {
+	// Reachable is true for each instruction that might run.
+	Reachable []bool
+
+	// After holds the range of each register after each instruction,
+	// indexed in the same way as the program. It is only meaningful for
+	// reachable instructions.
+	After []RegisterRanges
+
+	// Finishes is true if the program might run to the end, and End then
+	// holds the range of each register at the end.
+	Finishes bool
+	End      RegisterRanges
+
+	// Divisions holds a check for each reachable div or mod instruction
+	// whose divisor is a register, in program order.
+	Divisions []DivisionCheck
+}
+
+// Z returns the range of values that z might have at the end of the program,
+// and false if the program can never finish.
+func (r *RangeReport) Z() (Interval, bool) {
+	return r.End.Z, r.Finishes
+}
+
+// Unsafe returns the checks for the div and mod instructions that might fail.
+func (r *RangeReport) Unsafe() []DivisionCheck {
+	var unsafe []DivisionCheck
+	for _, c := range r.Divisions {
+		if c.Safety != DivisionSafe {
+			unsafe = append(unsafe, c)
+		}
+	}
+	return unsafe
+}
+
+// widenAfter is the number of times that analysis can visit an instruction
+// before any bound that is still growing jumps straight to its limit. This
+// makes sure that loops are analysed in a bounded number of steps.
+const widenAfter = 8
+
+// AnalyzeRanges works out the range of values that each register might hold
+// after each instruction, when every input is taken from the alphabet.
+// The ranges are safe bounds, but not always tight ones: the real values can
+// be anywhere inside them. Arithmetic that might overflow gives the full
+// range of an int.
+//
+// Unlike the other analyses, AnalyzeRanges understands control flow. A ret
+// instruction is assumed to return to after any call, and each loop is
+// widened after a few passes, so that the analysis always finishes.
+func AnalyzeRanges(code Program, alphabet []int) (*RangeReport, error) {
+	if len(alphabet) == 0 {
+		return nil, errors.New("the alphabet is empty")
+	}
+	input := Interval{alphabet[0], alphabet[0]}
+	for _, n := range alphabet[1:] {
+		input = input.union(Interval{n, n})
+	}
+
+	var returns []int
+	for i, inst := range code {
+		if inst.op == opCall {
+			returns = append(returns, i+1)
+		}
+	}
+
+	var (
+		states  = make([][4]Interval, len(code)+1) // the state before each index
+		reached = make([]bool, len(code)+1)
+		visits  = make([]int, len(code)+1)
+		work    = []int{0}
+	)
+	reached[0] = true
+
+	merge := func(i int, s [4]Interval) {
+		if !reached[i] {
+			reached[i], states[i] = true, s
+			work = append(work, i)
+			return
+		}
+		old, changed := states[i], false
+		for r := range s {
+			next := old[r].union(s[r])
+			if next == old[r] {
+				continue
+			}
+			if visits[i] >= widenAfter {
+				if next.Lo < old[r].Lo {
+					next.Lo = math.MinInt
+				}
+				if next.Hi > old[r].Hi {
+					next.Hi = math.MaxInt
+				}
+			}
+			states[i][r], changed = next, true
+		}
+		if changed {
+			work = append(work, i)
+		}
+	}
+
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i == len(code) {
+			continue
+		}
+		visits[i]++
+
+		after, ok := rangeStep(code[i], states[i], input)
+		switch inst := code[i]; inst.op {
+		case opJumpNotZero:
+			reg := states[i]
+			if taken, ok := reg[inst.r1].nonZero(); ok {
+				reg[inst.r1] = taken
+				merge(inst.p2.n, reg)
+			}
+			if reg := states[i]; reg[inst.r1].Contains(0) {
+				reg[inst.r1] = Interval{}
+				merge(i+1, reg)
+			}
+
+		case opJump, opCall:
+			merge(inst.p2.n, after)
+
+		case opReturn:
+			for _, ret := range returns {
+				merge(ret, after)
+			}
+
+		default:
+			if ok {
+				merge(i+1, after)
+			}
+		}
+	}
+
+	report := &RangeReport{
+		Reachable: reached[:len(code)],
+		After:     make([]RegisterRanges, len(code)),
+		Finishes:  reached[len(code)],
+		End:       registerRanges(states[len(code)]),
+	}
+	for i, inst := range code {
+		if !reached[i] {
+			continue
+		}
+		after, _ := rangeStep(inst, states[i], input)
+		report.After[i] = registerRanges(after)
+
+		r2, isReg := inst.p2.isRegister()
+		if (inst.op != opDivide && inst.op != opModulo) || !isReg {
+			continue
+		}
+		check := DivisionCheck{
+			Line:        inst.line,
+			Instruction: inst.String(),
+			Divisor:     states[i][r2],
+		}
+		switch {
+		case check.Divisor == Interval{}:
+			check.Safety = DivisionFails
+		case check.Divisor.Contains(0):
+			check.Safety = DivisionMayFail
+		}
+		report.Divisions = append(report.Divisions, check)
+	}
+	return report, nil
+}
+
+// rangeStep works out the range of each register after a single instruction,
+// and returns false if the instruction can never succeed. If the instruction
+// divides by a register, that register is assumed to be non-zero afterwards,
+// since the run would have failed otherwise.
+func rangeStep(inst instruction, reg [4]Interval, input Interval) ([4]Interval, bool) {
+	if inst.op.isControl() {
+		return reg, true
+	}
+	if inst.op == opInput {
+		reg[inst.r1] = input
+		return reg, true
+	}
+
+	x := reg[inst.r1]
+	y := Interval{inst.p2.n, inst.p2.n}
+	r2, isReg := inst.p2.isRegister()
+	if isReg {
+		y = reg[r2]
+	}
+
+	if inst.op == opDivide || inst.op == opModulo {
+		var ok bool
+		if y, ok = y.nonZero(); !ok {
+			return reg, false
+		}
+		if isReg {
+			reg[r2] = y
+			if r2 == inst.r1 {
+				x = y
+			}
+		}
+	}
+
+	var res Interval
+	if inst.op == opEquals {
+		switch {
+		case x.Lo == x.Hi && x == y:
+			res = Interval{1, 1}
+		case x.Hi < y.Lo || y.Hi < x.Lo:
+			res = Interval{0, 0}
+		default:
+			res = Interval{0, 1}
+		}
+	} else {
+		res.Lo, res.Hi = bounds(exprOps[inst.op], x, y)
+		if res.Lo == math.MinInt || res.Hi == math.MaxInt {
+			// the bounds saturated, so the result may have overflowed
+			// and wrapped around:
+			res = fullInterval
+		}
+	}
+
+	reg[inst.r1] = res
+	return reg, true
+}
@@ -0,0 +1,152 @@
+package alu
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeRanges(t *testing.T) {
+	digits := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	tt := []struct {
+		name      string
+		program   string
+		alphabet  []int
+		wantW     []Interval // wantW is the range of w after each instruction.
+		wantEnd   RegisterRanges
+		wantFinal bool
+		wantDivs  []DivisionSafety
+	}{
+		{
+			name:      "straight-line arithmetic",
+			program:   "inp w\nmul w 2\nadd w 1\nmod w 3\neql x w\n",
+			alphabet:  digits,
+			wantW:     []Interval{{1, 9}, {2, 18}, {3, 19}, {0, 2}, {0, 2}},
+			wantEnd:   RegisterRanges{W: Interval{0, 2}, X: Interval{0, 1}},
+			wantFinal: true,
+		},
+		{
+			name:      "a divisor is non-zero after a division succeeds",
+			program:   "inp w\ninp x\nmod w x\ndiv z x\n",
+			alphabet:  []int{0, 1, 2},
+			wantW:     []Interval{{0, 2}, {0, 2}, {0, 1}, {0, 1}},
+			wantEnd:   RegisterRanges{W: Interval{0, 1}, X: Interval{1, 2}},
+			wantFinal: true,
+			wantDivs:  []DivisionSafety{DivisionMayFail, DivisionSafe},
+		},
+		{
+			name:     "dividing by a register that is always 0",
+			program:  "inp w\ndiv w y\nadd w 1\n",
+			alphabet: digits,
+			wantW:    []Interval{{1, 9}, {1, 9}, {}},
+			wantDivs: []DivisionSafety{DivisionFails},
+		},
+		{
+			name:      "equality of constants",
+			program:   "add w 3\nadd x 3\neql w x\neql x 4\n",
+			alphabet:  digits,
+			wantW:     []Interval{{3, 3}, {3, 3}, {1, 1}, {1, 1}},
+			wantEnd:   RegisterRanges{W: Interval{1, 1}},
+			wantFinal: true,
+		},
+		{
+			name:      "overflow gives the full range",
+			program:   "inp w\nmul w 4611686018427387904\n",
+			alphabet:  digits,
+			wantW:     []Interval{{1, 9}, fullInterval},
+			wantEnd:   RegisterRanges{W: fullInterval},
+			wantFinal: true,
+		},
+		{
+			name:      "a jnz refines its register",
+			program:   "inp w\nloop: add z 1\nadd w -1\njnz w loop\n",
+			alphabet:  digits,
+			wantW:     []Interval{{1, 9}, {1, 9}, {0, 8}, {0, 8}},
+			wantEnd:   RegisterRanges{Z: fullInterval},
+			wantFinal: true,
+		},
+		{
+			name:      "calls and returns",
+			program:   "call f\nadd z 1\njmp end\nf: mul z 0\nadd z 5\nret\nend:\n",
+			alphabet:  digits,
+			wantW:     []Interval{{}, {}, {}, {}, {}, {}},
+			wantEnd:   RegisterRanges{Z: Interval{6, 6}},
+			wantFinal: true,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, a := require.New(t), assert.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			got, err := AnalyzeRanges(code, tc.alphabet)
+			r.NoError(err)
+
+			var w []Interval
+			for i, after := range got.After {
+				if got.Reachable[i] {
+					w = append(w, after.W)
+				} else {
+					w = append(w, Interval{})
+				}
+			}
+			a.Equal(tc.wantW, w)
+
+			a.Equal(tc.wantFinal, got.Finishes)
+			if tc.wantFinal {
+				a.Equal(tc.wantEnd, got.End)
+			}
+
+			var divs []DivisionSafety
+			for _, c := range got.Divisions {
+				divs = append(divs, c.Safety)
+			}
+			a.Equal(tc.wantDivs, divs)
+		})
+	}
+}
+
+func TestAnalyzeRanges_unreachable(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte("jmp end\ndiv z w\nend:\n"))
+	r.NoError(err)
+
+	got, err := AnalyzeRanges(code, []int{0})
+	r.NoError(err)
+	a.Equal([]bool{true, false}, got.Reachable)
+	a.Empty(got.Divisions)
+	a.True(got.Finishes)
+}
+
+func TestAnalyzeRanges_day24(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+	code, err := Compile(src)
+	r.NoError(err)
+
+	got, err := AnalyzeRanges(code, []int{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	r.NoError(err)
+	a.Empty(got.Unsafe())
+
+	z, ok := got.Z()
+	r.True(ok)
+	a.True(z.Contains(0), "z is in %v", z)
+	a.Greater(z.Lo, math.MinInt)
+}
+
+func TestAnalyzeRanges_emptyAlphabet(t *testing.T) {
+	_, err := AnalyzeRanges(nil, nil)
+	assert.EqualError(t, err, "the alphabet is empty")
+}
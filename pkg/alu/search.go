@@ -0,0 +1,197 @@
+package alu
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Registers holds a value for each of the ALU's registers.
+type Registers struct {
+	W, X, Y, Z int
+}
+
+// registers converts the ALU's internal register array to a Registers value.
+func registers(reg [4]int) Registers {
+	return Registers{W: reg[0], X: reg[1], Y: reg[2], Z: reg[3]}
+}
+
+// Condition decides if the final state of the registers is acceptable.
+type Condition func(Registers) bool
+
+// ZeroZ is a Condition that accepts any run which leaves z equal to 0.
+func ZeroZ(r Registers) bool {
+	return r.Z == 0
+}
+
+// ErrNoSolution is returned when a search finds that no input is accepted.
+var ErrNoSolution = errors.New("no input is accepted by the program")
+
+// FindLargest searches for the lexicographically largest sequence of inputs
+// that the program accepts. Each input value is taken from the alphabet, and
+// the program must read exactly 'length' inputs. A sequence is accepted if it
+// runs without error and the registers then satisfy the condition.
+//
+// The program is split at each inp instruction, and each piece is run once
+// for every distinct register state that reaches it. Registers that will be
+// overwritten before they are next read are ignored when comparing states,
+// so that programs like the day 24 MONAD finish quickly. The program must not
+// use any control flow instructions.
+func FindLargest(code Program, alphabet []int, length int, accept Condition) ([]int, error) {
+	order := append([]int(nil), alphabet...)
+	sort.Sort(sort.Reverse(sort.IntSlice(order)))
+	return search(code, order, length, accept)
+}
+
+// FindSmallest searches for the lexicographically smallest sequence of inputs
+// that the program accepts. See FindLargest for details.
+func FindSmallest(code Program, alphabet []int, length int, accept Condition) ([]int, error) {
+	order := append([]int(nil), alphabet...)
+	sort.Ints(order)
+	return search(code, order, length, accept)
+}
+
+// search performs a depth-first search, trying the values from the alphabet
+// in the given order at each position.
+func search(code Program, alphabet []int, length int, accept Condition) ([]int, error) {
+	if len(alphabet) == 0 {
+		return nil, errors.New("the input alphabet is empty")
+	}
+	if err := straightLine(code); err != nil {
+		return nil, errors.Wrap(err, "cannot search the program")
+	}
+
+	s := searcher{
+		alphabet: alphabet,
+		accept:   accept,
+		live:     liveness(code),
+		failed:   make(map[searchState]struct{}, 1<<16),
+		alu:      New(code),
+	}
+
+	for i, inst := range s.code() {
+		if inst.op == opInput {
+			s.inputs = append(s.inputs, i)
+		}
+	}
+	if len(s.inputs) != length {
+		return nil, errors.Errorf("the program reads %d inputs, not %d", len(s.inputs), length)
+	}
+
+	// run everything before the first inp instruction:
+	if _, err := s.alu.execute(0, s.segmentEnd(-1)); err != nil {
+		return nil, ErrNoSolution
+	}
+
+	found, ok := s.search(0, s.alu.reg)
+	if !ok {
+		return nil, ErrNoSolution
+	}
+	return found, nil
+}
+
+// searcher holds the state of a search for an accepted input.
+type searcher struct {
+	alphabet []int
+	accept   Condition
+	inputs   []int   // inputs holds the index of each inp instruction.
+	live     []uint8 // live holds the live registers before each instruction.
+	failed   map[searchState]struct{}
+	alu      *ALU
+}
+
+// searchState identifies a point in the search: the index of the next input
+// to read, along with the values of the live registers.
+type searchState struct {
+	next int
+	reg  [4]int
+}
+
+// search tries each value in the alphabet for input k, given the state
+// of the registers just before reading it. It returns the first accepted
+// sequence of values for inputs k onward.
+func (s *searcher) search(k int, reg [4]int) ([]int, bool) {
+	if k == len(s.inputs) {
+		return nil, s.accept(registers(reg))
+	}
+
+	inp := s.code()[s.inputs[k]]
+	live := s.live[s.inputs[k]]
+	for i := range reg {
+		if live&(1<<i) == 0 {
+			reg[i] = 0
+		}
+	}
+
+	state := searchState{next: k, reg: reg}
+	if _, ok := s.failed[state]; ok {
+		return nil, false
+	}
+
+	start, end := s.inputs[k]+1, s.segmentEnd(k)
+	for _, n := range s.alphabet {
+		s.alu.reg = reg
+		s.alu.set(inp.r1, n)
+		if _, err := s.alu.execute(start, end); err != nil {
+			continue
+		}
+
+		if rest, ok := s.search(k+1, s.alu.reg); ok {
+			return append([]int{n}, rest...), true
+		}
+	}
+
+	s.failed[state] = struct{}{}
+	return nil, false
+}
+
+// segmentEnd returns the index of the instruction that follows the segment
+// for input k: either the next inp instruction or the end of the program.
+// Use k = -1 for the segment before the first input.
+func (s *searcher) segmentEnd(k int) int {
+	if k+1 < len(s.inputs) {
+		return s.inputs[k+1]
+	}
+	return len(s.code())
+}
+
+func (s *searcher) code() Program {
+	return s.alu.code
+}
+
+// liveness calculates which registers are live just before each instruction:
+// that is, which registers might be read before they are next written.
+// The result is a bit mask, with bit 0 for w, bit 1 for x, and so on.
+// Every register is assumed to be live at the end of the program.
+func liveness(code Program) []uint8 {
+	live := make([]uint8, len(code))
+	after := uint8(0b1111)
+	for i := len(code) - 1; i >= 0; i-- {
+		use, def := usesDefs(code[i])
+		after = after&^def | use
+		live[i] = after
+	}
+	return live
+}
+
+// usesDefs returns bit masks of the registers read and written by inst.
+func usesDefs(inst instruction) (use, def uint8) {
+	switch inst.op {
+	case opJumpNotZero:
+		return 1 << inst.r1, 0
+	case opJump, opCall, opReturn:
+		return 0, 0
+	}
+
+	def = 1 << inst.r1
+	switch inst.p2.kind {
+	case registerOperand:
+		use = def | 1<<inst.p2.reg
+	case immediateOperand:
+		// multiplying by 0 clears the register without needing its value
+		if inst.op != opMultiply || inst.p2.n != 0 {
+			use = def
+		}
+	}
+	return use, def
+}
@@ -0,0 +1,164 @@
+package alu
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	digits := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	tt := []struct {
+		name         string
+		program      string
+		alphabet     []int
+		length       int
+		accept       Condition
+		wantLargest  []int
+		wantSmallest []int
+		wantErr      bool
+	}{
+		{
+			name: "the two inputs must add to 10",
+			program: `inp w
+add z w
+inp w
+add z w
+add z -10
+`,
+			alphabet:     digits,
+			length:       2,
+			accept:       ZeroZ,
+			wantLargest:  []int{9, 1},
+			wantSmallest: []int{1, 9},
+		},
+		{
+			name: "the first input must be 2 more than the second",
+			program: `inp x
+add x -2
+inp w
+eql x w
+`,
+			alphabet:     digits,
+			length:       2,
+			accept:       func(r Registers) bool { return r.X == 1 },
+			wantLargest:  []int{9, 7},
+			wantSmallest: []int{3, 1},
+		},
+		{
+			name: "inputs that divide by zero are rejected",
+			program: `inp w
+inp x
+div w x
+`,
+			alphabet:     []int{0, 1},
+			length:       2,
+			accept:       func(Registers) bool { return true },
+			wantLargest:  []int{1, 1},
+			wantSmallest: []int{0, 1},
+		},
+		{
+			name:     "no solution",
+			program:  "inp z\n",
+			alphabet: digits,
+			length:   1,
+			accept:   ZeroZ,
+			wantErr:  true,
+		},
+		{
+			name:     "wrong number of inputs",
+			program:  "inp z\n",
+			alphabet: digits,
+			length:   2,
+			accept:   ZeroZ,
+			wantErr:  true,
+		},
+		{
+			name:     "control flow",
+			program:  "inp z\njnz z end\nend:\n",
+			alphabet: digits,
+			length:   1,
+			accept:   ZeroZ,
+			wantErr:  true,
+		},
+		{
+			name:     "empty alphabet",
+			program:  "inp z\n",
+			alphabet: nil,
+			length:   1,
+			accept:   ZeroZ,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, a := require.New(t), assert.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			largest, err := FindLargest(code, tc.alphabet, tc.length, tc.accept)
+			if tc.wantErr {
+				r.Error(err)
+				return
+			}
+			r.NoError(err)
+			a.Equal(tc.wantLargest, largest)
+
+			smallest, err := FindSmallest(code, tc.alphabet, tc.length, tc.accept)
+			r.NoError(err)
+			a.Equal(tc.wantSmallest, smallest)
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	code, err := Compile([]byte(`inp w
+mul x 0
+add x z
+mul y 0
+add y w
+add z y
+`))
+	require.NoError(t, err)
+
+	const w, x, y, z = 1, 2, 4, 8
+	want := []uint8{
+		z,
+		w | z,
+		w | x | z,
+		w | x | z,
+		w | y | x | z,
+		w | x | y | z,
+	}
+	assert.Equal(t, want, liveness(code))
+}
+
+func TestFind_day24(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping search of the day 24 program in short mode")
+	}
+	r, a := require.New(t), assert.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+
+	code, err := Compile(src)
+	r.NoError(err)
+
+	digits := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	largest, err := FindLargest(code, digits, 14, ZeroZ)
+	r.NoError(err)
+	a.Equal([]int{9, 4, 3, 9, 9, 8, 9, 8, 9, 4, 9, 9, 5, 9}, largest)
+
+	smallest, err := FindSmallest(code, digits, 14, ZeroZ)
+	r.NoError(err)
+	a.Equal([]int{2, 1, 1, 7, 6, 1, 2, 1, 6, 1, 1, 5, 1, 1}, smallest)
+}
@@ -0,0 +1,129 @@
+package alu
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SMTOptions control the constraints written by GenerateSMT.
+type SMTOptions struct {
+	// Inputs bounds the value of every input.
+	Inputs Interval
+
+	// Goal is an SMT-LIB formula that must hold at the end of the program.
+	// It can refer to the final value of each register as w, x, y and z,
+	// and to each input as in0, in1, and so on. The default is "(= z 0)".
+	Goal string
+}
+
+// smtPrelude defines the ALU's division and modulo in SMT-LIB, whose own
+// div and mod are Euclidean rather than truncated.
+const smtPrelude = `(define-fun alu-div ((a Int) (b Int)) Int
+  (ite (= (>= a 0) (>= b 0)) (div (abs a) (abs b)) (- (div (abs a) (abs b)))))
+(define-fun alu-mod ((a Int) (b Int)) Int
+  (- a (* b (alu-div a b))))
+`
+
+// GenerateSMT translates the program into SMT-LIB v2 constraints, which a
+// solver such as Z3 or CVC5 can use to find inputs that reach the goal.
+//
+// Each input is a variable, bounded by opts.Inputs, and each instruction
+// defines a new version of its register, so that the registers are in
+// static single assignment form: w0 is the initial value of w, w1 is its
+// value after the first instruction that writes it, and so on. The
+// constraints also rule out any division by zero, so every solution is an
+// input that the ALU can run without an error.
+//
+// Registers are unbounded integers, so the constraints only describe the
+// ALU for inputs where no instruction overflows. The program must not use
+// jnz, jmp, call or ret.
+func GenerateSMT(code Program, opts SMTOptions) ([]byte, error) {
+	if opts.Inputs.Lo > opts.Inputs.Hi {
+		return nil, errors.Errorf("invalid input range %v", opts.Inputs)
+	}
+	if opts.Goal == "" {
+		opts.Goal = "(= z 0)"
+	}
+
+	inputs := 0
+	for _, inst := range code {
+		if inst.op.isControl() {
+			return nil, errors.Errorf("%s: %s is not supported in SMT-LIB", inst.where(), inst.op)
+		}
+		if inst.op == opInput {
+			inputs++
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "; generated by alu.GenerateSMT\n(set-logic QF_NIA)\n%s\n", smtPrelude)
+
+	names := make([]string, inputs)
+	for i := range names {
+		names[i] = fmt.Sprintf("in%d", i)
+		fmt.Fprintf(&buf, "(declare-const %s Int)\n", names[i])
+		fmt.Fprintf(&buf, "(assert (and (<= %s %s) (<= %s %s)))\n",
+			smtInt(opts.Inputs.Lo), names[i], names[i], smtInt(opts.Inputs.Hi))
+	}
+	buf.WriteString("\n")
+
+	var version [4]int
+	reg := func(r registerID) string {
+		return fmt.Sprintf("%s%d", r, version[r&3])
+	}
+	for r := registerID(0); r < 4; r++ {
+		fmt.Fprintf(&buf, "(define-fun %s () Int 0)\n", reg(r))
+	}
+
+	next := 0
+	for _, inst := range code {
+		fmt.Fprintf(&buf, "; %s: %s\n", inst.where(), inst)
+
+		a, b := reg(inst.r1), smtInt(inst.p2.n)
+		if r, ok := inst.p2.isRegister(); ok {
+			b = reg(r)
+		}
+
+		var term string
+		switch inst.op {
+		case opInput:
+			term = names[next]
+			next++
+		case opAdd:
+			term = fmt.Sprintf("(+ %s %s)", a, b)
+		case opMultiply:
+			term = fmt.Sprintf("(* %s %s)", a, b)
+		case opDivide, opModulo:
+			if inst.p2.kind == registerOperand {
+				fmt.Fprintf(&buf, "(assert (not (= %s 0)))\n", b)
+			}
+			term = fmt.Sprintf("(alu-%s %s %s)", inst.op, a, b)
+		case opEquals:
+			term = fmt.Sprintf("(ite (= %s %s) 1 0)", a, b)
+		}
+
+		version[inst.r1&3]++
+		fmt.Fprintf(&buf, "(define-fun %s () Int %s)\n", reg(inst.r1), term)
+	}
+
+	buf.WriteString("\n")
+	for r := registerID(0); r < 4; r++ {
+		fmt.Fprintf(&buf, "(define-fun %s () Int %s)\n", r, reg(r))
+	}
+	fmt.Fprintf(&buf, "(assert %s)\n(check-sat)\n", opts.Goal)
+	if inputs > 0 {
+		fmt.Fprintf(&buf, "(get-value (%s))\n", strings.Join(names, " "))
+	}
+	return buf.Bytes(), nil
+}
+
+// smtInt writes an integer constant. SMT-LIB has no negative literals.
+func smtInt(n int) string {
+	if n < 0 {
+		return fmt.Sprintf("(- %d)", -uint(n))
+	}
+	return fmt.Sprint(n)
+}
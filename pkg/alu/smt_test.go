@@ -0,0 +1,251 @@
+package alu
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestGenerateSMT(t *testing.T) {
+	tt := []struct {
+		name string
+		opts SMTOptions
+	}{
+		{
+			name: "ops",
+			opts: SMTOptions{Inputs: Interval{Lo: -3, Hi: 3}, Goal: "(= y z)"},
+		},
+		{
+			name: "digits",
+			opts: SMTOptions{Inputs: Interval{Lo: 1, Hi: 9}},
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			code, err := CompileFS(os.DirFS("testdata/smt"), tc.name+".alu")
+			r.NoError(err)
+
+			got, err := GenerateSMT(code, tc.opts)
+			r.NoError(err)
+
+			golden := filepath.Join("testdata", "smt", tc.name+".smt2")
+			if *update {
+				r.NoError(os.WriteFile(golden, got, 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			r.NoError(err)
+			r.Equal(string(want), string(got))
+		})
+	}
+}
+
+func TestGenerateSMT_errors(t *testing.T) {
+	code, err := Compile([]byte("inp w\nloop: add z w\njnz w loop\n"))
+	require.NoError(t, err)
+	_, err = GenerateSMT(code, SMTOptions{})
+	assert.EqualError(t, err, "line 3: jnz is not supported in SMT-LIB")
+
+	code, err = Compile([]byte("inp w\n"))
+	require.NoError(t, err)
+	_, err = GenerateSMT(code, SMTOptions{Inputs: Interval{Lo: 9, Hi: 1}})
+	assert.EqualError(t, err, "invalid input range [9, 1]")
+}
+
+// TestGenerateSMT_eval evaluates the constraints for some inputs, and
+// compares the final registers with the ALU's, so that the translation is
+// checked without a solver.
+func TestGenerateSMT_eval(t *testing.T) {
+	r := require.New(t)
+
+	code, err := CompileFS(os.DirFS("testdata/smt"), "ops.alu")
+	r.NoError(err)
+	src, err := GenerateSMT(code, SMTOptions{Inputs: Interval{Lo: -3, Hi: 3}, Goal: "true"})
+	r.NoError(err)
+
+	for w := -3; w <= 3; w++ {
+		for x := -3; x <= 3; x++ {
+			calc := New(code)
+			_, runErr := calc.Run(Ints(w, x))
+
+			env := smtEnv{vars: map[string]int{"in0": w, "in1": x}, funcs: map[string]smtFunc{}}
+			evalErr := env.run(string(src))
+			if runErr != nil {
+				assert.EqualError(t, evalErr, "assertion failed", "inputs %d %d", w, x)
+				continue
+			}
+			r.NoError(evalErr)
+
+			reg := calc.Snapshot().Registers
+			want := []int{reg.W, reg.X, reg.Y, reg.Z}
+			got := []int{env.vars["w"], env.vars["x"], env.vars["y"], env.vars["z"]}
+			assert.Equal(t, want, got, "inputs %d %d", w, x)
+		}
+	}
+}
+
+// TestGenerateSMT_solver runs Z3 on the constraints, if it is installed.
+func TestGenerateSMT_solver(t *testing.T) {
+	z3, err := exec.LookPath("z3")
+	if err != nil {
+		t.Skip("z3 is not installed")
+	}
+	r := require.New(t)
+
+	code, err := CompileFS(os.DirFS("testdata/smt"), "digits.alu")
+	r.NoError(err)
+	src, err := GenerateSMT(code, SMTOptions{Inputs: Interval{Lo: 1, Hi: 9}})
+	r.NoError(err)
+
+	cmd := exec.Command(z3, "-in")
+	cmd.Stdin = strings.NewReader(string(src))
+	out, err := cmd.Output()
+	r.NoError(err)
+	r.True(strings.HasPrefix(string(out), "sat\n"), "%s", out)
+}
+
+// smtEnv evaluates the small subset of SMT-LIB that GenerateSMT writes,
+// with every declared constant already given a value. Booleans are 0 or 1.
+type smtEnv struct {
+	vars  map[string]int
+	funcs map[string]smtFunc
+}
+
+type smtFunc struct {
+	params []string
+	body   interface{}
+}
+
+func (env *smtEnv) run(src string) error {
+	var lines []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	text := strings.NewReplacer("(", " ( ", ")", " ) ").Replace(strings.Join(lines, " "))
+	tokens := strings.Fields(text)
+
+	for len(tokens) > 0 {
+		var form interface{}
+		form, tokens = parseSexpr(tokens)
+		list := form.([]interface{})
+		switch list[0] {
+		case "define-fun":
+			var params []string
+			for _, p := range list[2].([]interface{}) {
+				params = append(params, p.([]interface{})[0].(string))
+			}
+			if len(params) == 0 {
+				env.vars[list[1].(string)] = env.eval(list[4], nil)
+			} else {
+				env.funcs[list[1].(string)] = smtFunc{params: params, body: list[4]}
+			}
+		case "assert":
+			if env.eval(list[1], nil) == 0 {
+				return fmt.Errorf("assertion failed")
+			}
+		}
+	}
+	return nil
+}
+
+func parseSexpr(tokens []string) (interface{}, []string) {
+	if tokens[0] != "(" {
+		return tokens[0], tokens[1:]
+	}
+	var list []interface{}
+	tokens = tokens[1:]
+	for tokens[0] != ")" {
+		var item interface{}
+		item, tokens = parseSexpr(tokens)
+		list = append(list, item)
+	}
+	return list, tokens[1:]
+}
+
+func (env *smtEnv) eval(form interface{}, local map[string]int) int {
+	if atom, ok := form.(string); ok {
+		if n, err := strconv.Atoi(atom); err == nil {
+			return n
+		}
+		if atom == "true" {
+			return 1
+		}
+		if n, ok := local[atom]; ok {
+			return n
+		}
+		return env.vars[atom]
+	}
+
+	list := form.([]interface{})
+	args := make([]int, len(list)-1)
+	for i, arg := range list[1:] {
+		args[i] = env.eval(arg, local)
+	}
+	b := func(ok bool) int {
+		if ok {
+			return 1
+		}
+		return 0
+	}
+
+	switch list[0] {
+	case "+":
+		return args[0] + args[1]
+	case "-":
+		if len(args) == 1 {
+			return -args[0]
+		}
+		return args[0] - args[1]
+	case "*":
+		return args[0] * args[1]
+	case "div", "mod":
+		q, m := divMod(int64(args[0]), int64(args[1]), EuclideanDivision)
+		if list[0] == "div" {
+			return int(q)
+		}
+		return int(m)
+	case "abs":
+		if args[0] < 0 {
+			return -args[0]
+		}
+		return args[0]
+	case "ite":
+		if args[0] != 0 {
+			return args[1]
+		}
+		return args[2]
+	case "=":
+		return b(args[0] == args[1])
+	case "<=":
+		return b(args[0] <= args[1])
+	case ">=":
+		return b(args[0] >= args[1])
+	case "not":
+		return b(args[0] == 0)
+	case "and":
+		return b(args[0] != 0 && args[1] != 0)
+	}
+
+	fn := env.funcs[list[0].(string)]
+	vars := make(map[string]int, len(fn.params))
+	for i, p := range fn.params {
+		vars[p] = args[i]
+	}
+	return env.eval(fn.body, vars)
+}
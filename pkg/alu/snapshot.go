@@ -0,0 +1,67 @@
+package alu
+
+import "github.com/pkg/errors"
+
+// Snapshot is the saved state of an ALU part way through a run.
+type Snapshot struct {
+	Registers Registers
+	PC        int   // PC is the index of the next instruction to execute.
+	Stack     []int // Stack holds the return address of each call in progress.
+	Consumed  []int // Consumed holds the input values read so far, in order.
+}
+
+// Snapshot saves the current state of the ALU. This is most useful after a
+// run stops early: for example, a run that stops with an *EndOfInputError
+// can be restored many times and resumed with different input each time,
+// without running the instructions before that point again.
+func (a *ALU) Snapshot() Snapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return Snapshot{
+		Registers: registers(a.reg),
+		PC:        a.pc,
+		Stack:     append([]int(nil), a.stack...),
+		Consumed:  append([]int(nil), a.consumed...),
+	}
+}
+
+// Restore loads a state saved by Snapshot, ready to continue with Resume.
+// The snapshot may come from any ALU running the same program.
+func (a *ALU) Restore(s Snapshot) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s.PC < 0 || s.PC > len(a.code) {
+		return errors.Errorf("program counter %d is outside the program", s.PC)
+	}
+	if len(s.Stack) > MaxCallDepth {
+		return errors.Errorf("the call stack is deeper than %d", MaxCallDepth)
+	}
+	for _, ret := range s.Stack {
+		if ret < 0 || ret > len(a.code) {
+			return errors.Errorf("return address %d is outside the program", ret)
+		}
+	}
+
+	r := s.Registers
+	reg := [4]int{r.W, r.X, r.Y, r.Z}
+	if bits := a.opts.Width.bits(); bits != 0 {
+		for i, n := range reg {
+			if !fits(int64(n), bits) {
+				return errors.Errorf("register %s holds %d, which does not fit in %d bits", registerID(i), n, bits)
+			}
+		}
+	}
+
+	a.reg = reg
+	if a.big != nil {
+		for i, n := range reg {
+			a.big[i].SetInt64(int64(n))
+		}
+	}
+	a.pc = s.PC
+	a.stack = append(a.stack[:0], s.Stack...)
+	a.consumed = append(a.consumed[:0], s.Consumed...)
+	return nil
+}
@@ -0,0 +1,97 @@
+package alu
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunContext_budget(t *testing.T) {
+	src := `inp w
+mul x 0
+add x w
+add x 4
+eql y x
+eql y 0
+mul z 3
+add z 1
+`
+	code, err := Compile([]byte(src))
+	require.NoError(t, err)
+
+	for budget := 1; budget <= len(code)+1; budget++ {
+		calc := New(code)
+		calc.SetBudget(budget)
+		_, err := calc.RunContext(context.Background(), Ints(7))
+
+		// the reference is the debugger, which runs one step at a time:
+		d := NewDebugger(code, Ints(7))
+		for i := 0; i < budget && !d.Finished(); i++ {
+			require.NoError(t, d.Step())
+		}
+
+		if budget < len(code) {
+			assert.ErrorIs(t, err, ErrBudgetExceeded, "budget %d", budget)
+		} else {
+			assert.NoError(t, err, "budget %d", budget)
+		}
+
+		snap := calc.Snapshot()
+		assert.Equal(t, d.Steps(), snap.PC, "budget %d", budget)
+		assert.Equal(t, d.Registers(), snap.Registers, "budget %d", budget)
+	}
+}
+
+func TestRunContext_cancelled(t *testing.T) {
+	code, err := Compile([]byte("inp w\nadd z w\n"))
+	require.NoError(t, err)
+	calc := New(code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = calc.RunContext(ctx, Ints(1))
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, calc.Snapshot().PC)
+
+	// resuming with a live context finishes the run:
+	got, err := calc.Resume(context.Background(), Ints(5))
+	require.NoError(t, err)
+	assert.Equal(t, 5, got)
+}
+
+func TestSnapshot_fork(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+	code, err := Compile(src)
+	r.NoError(err)
+
+	// run as far as the fifth input, and save the state there:
+	calc := New(code)
+	_, err = calc.Run(Digits("1357"))
+	var eoi *EndOfInputError
+	r.True(errors.As(err, &eoi))
+
+	prefix := calc.Snapshot()
+	r.Equal([]int{1, 3, 5, 7}, prefix.Consumed)
+
+	fresh := New(code)
+	for _, suffix := range []string{"9246897531", "1111111111", "9999999999"} {
+		want, err := fresh.Run(Digits("1357" + suffix))
+		r.NoError(err)
+
+		r.NoError(calc.Restore(prefix))
+		got, err := calc.Resume(context.Background(), Digits(suffix))
+		r.NoError(err)
+		r.Equal(want, got, "suffix %s", suffix)
+		r.Equal(fresh.Snapshot(), calc.Snapshot())
+	}
+
+	r.Error(calc.Restore(Snapshot{PC: len(code) + 1}))
+}
@@ -0,0 +1,594 @@
+package alu
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExprOp identifies the kind of node in a symbolic expression.
+type ExprOp byte
+
+const (
+	ExprConst ExprOp = iota // an integer constant
+	ExprInput               // one of the values read by an inp instruction
+	ExprAdd                 // the sum of two expressions
+	ExprMul                 // the product of two expressions
+	ExprDiv                 // the quotient of two expressions (truncated)
+	ExprMod                 // the remainder after dividing two expressions
+	ExprEql                 // 1 if two expressions are equal, otherwise 0
+)
+
+// symbol is the infix operator used when printing each kind of expression.
+var symbol = [...]string{
+	ExprAdd: "+",
+	ExprMul: "*",
+	ExprDiv: "/",
+	ExprMod: "%",
+	ExprEql: "==",
+}
+
+// Expr is a node in a symbolic expression DAG. Identical sub-expressions
+// produced by the same symbolic run are represented by the same *Expr, so
+// pointer equality implies structural equality.
+type Expr struct {
+	op     ExprOp
+	val    int   // val is the value of a constant, or the index of an input.
+	x, y   *Expr // x and y are the operands, if op is not ExprConst or ExprInput.
+	lo, hi int   // lo and hi bound the values this expression might take.
+	fails  bool  // fails is true if evaluating the expression might fail.
+}
+
+// Op returns the kind of this expression.
+func (e *Expr) Op() ExprOp {
+	return e.op
+}
+
+// Value returns the value of a constant, or the index of an input.
+func (e *Expr) Value() int {
+	return e.val
+}
+
+// Operands returns the two operands of a binary expression.
+func (e *Expr) Operands() (x, y *Expr) {
+	return e.x, e.y
+}
+
+// Range returns the lower and upper bound of the values this expression can
+// take, given the alphabet of inputs that was used to create it.
+func (e *Expr) Range() (lo, hi int) {
+	return e.lo, e.hi
+}
+
+// IsConst returns true if this expression is the given constant.
+func (e *Expr) IsConst(n int) bool {
+	return e.op == ExprConst && e.val == n
+}
+
+// Eval calculates the value of this expression for the given inputs,
+// with the same semantics as the ALU.
+func (e *Expr) Eval(inputs []int) (int, error) {
+	memo := make(map[*Expr]int)
+	return e.eval(inputs, memo)
+}
+
+func (e *Expr) eval(inputs []int, memo map[*Expr]int) (int, error) {
+	if n, ok := memo[e]; ok {
+		return n, nil
+	}
+
+	var n int
+	switch e.op {
+	case ExprConst:
+		return e.val, nil
+
+	case ExprInput:
+		if e.val >= len(inputs) {
+			return 0, errors.Errorf("missing input %d", e.val)
+		}
+		return inputs[e.val], nil
+
+	default:
+		a, err := e.x.eval(inputs, memo)
+		if err != nil {
+			return 0, err
+		}
+		b, err := e.y.eval(inputs, memo)
+		if err != nil {
+			return 0, err
+		}
+		if n, err = apply(e.op, a, b); err != nil {
+			return 0, err
+		}
+	}
+
+	memo[e] = n
+	return n, nil
+}
+
+// apply performs a binary operation on two concrete values.
+func apply(op ExprOp, a, b int) (int, error) {
+	switch op {
+	case ExprAdd:
+		return a + b, nil
+	case ExprMul:
+		return a * b, nil
+	case ExprDiv:
+		if b == 0 {
+			return 0, errors.New("divide by 0")
+		}
+		return a / b, nil
+	case ExprMod:
+		if b == 0 {
+			return 0, errors.New("modulo of 0 is undefined")
+		}
+		return a % b, nil
+	case ExprEql:
+		if a == b {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, errors.Errorf("cannot apply operation %d", op)
+	}
+}
+
+// String implements fmt.Stringer, writing the expression in infix notation.
+// Shared sub-expressions are written out in full each time they are used,
+// so the result may be large; see Format for a more compact alternative.
+func (e *Expr) String() string {
+	var sb strings.Builder
+	e.write(&sb, nil)
+	return sb.String()
+}
+
+// Format implements fmt.Formatter.
+// The %v and %s verbs give the same output as String. Adding the '+' flag
+// (%+v) instead writes each shared sub-expression once, as a numbered
+// temporary 't1 = ...' on its own line, followed by the expression itself.
+func (e *Expr) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v', 's':
+	default:
+		fmt.Fprintf(s, "%%!%c(*alu.Expr)", verb)
+		return
+	}
+
+	if !s.Flag('+') {
+		fmt.Fprint(s, e.String())
+		return
+	}
+
+	// count the parents of every node, to find which are shared:
+	uses := make(map[*Expr]int)
+	order := make([]*Expr, 0, 64)
+	var visit func(*Expr)
+	visit = func(n *Expr) {
+		uses[n]++
+		if uses[n] > 1 || n.x == nil {
+			return
+		}
+		visit(n.x)
+		visit(n.y)
+		order = append(order, n)
+	}
+	visit(e)
+
+	names := make(map[*Expr]string)
+	var sb strings.Builder
+	for _, n := range order {
+		if uses[n] < 2 || n == e {
+			continue
+		}
+		sb.Reset()
+		n.write(&sb, names)
+		names[n] = fmt.Sprintf("t%d", len(names)+1)
+		fmt.Fprintf(s, "%s = %s\n", names[n], sb.String())
+	}
+
+	sb.Reset()
+	e.write(&sb, names)
+	fmt.Fprint(s, sb.String())
+}
+
+// write this expression to sb, using the given names for sub-expressions.
+func (e *Expr) write(sb *strings.Builder, names map[*Expr]string) {
+	if name, ok := names[e]; ok {
+		sb.WriteString(name)
+		return
+	}
+
+	switch e.op {
+	case ExprConst:
+		fmt.Fprintf(sb, "%d", e.val)
+	case ExprInput:
+		fmt.Fprintf(sb, "in%d", e.val)
+	default:
+		sb.WriteByte('(')
+		e.x.write(sb, names)
+		fmt.Fprintf(sb, " %s ", symbol[e.op])
+		e.y.write(sb, names)
+		sb.WriteByte(')')
+	}
+}
+
+// SymbolicRegisters holds the symbolic value of each of the ALU's registers.
+type SymbolicRegisters struct {
+	W, X, Y, Z *Expr
+
+	// Inputs is the number of inp instructions that were executed.
+	Inputs int
+}
+
+// RunSymbolic executes the program without concrete input. Instead, each inp
+// instruction reads a new symbolic input in0, in1, ... which is assumed to
+// be in the range [lo, hi]. The result holds an expression for each register
+// after the last instruction, in terms of those inputs.
+//
+// Expressions are simplified as they are built, using constant folding,
+// algebraic identities, and the known range of each sub-expression.
+// An error is returned if the program would always divide by zero, or if it
+// uses any control flow instructions.
+func RunSymbolic(code Program, lo, hi int) (SymbolicRegisters, error) {
+	if lo > hi {
+		return SymbolicRegisters{}, errors.Errorf("empty input range [%d, %d]", lo, hi)
+	}
+	if err := straightLine(code); err != nil {
+		return SymbolicRegisters{}, err
+	}
+	return runSymbolic(newExprBuilder(), code, lo, hi)
+}
+
+// runSymbolic is RunSymbolic, building its expressions with b. Runs that
+// share a builder also share their identical sub-expressions.
+func runSymbolic(b *exprBuilder, code Program, lo, hi int) (SymbolicRegisters, error) {
+	zero := b.constant(0)
+	reg := [4]*Expr{zero, zero, zero, zero}
+	inputs := 0
+
+	for _, inst := range code {
+		i := inst.r1
+		if inst.op == opInput {
+			reg[i] = b.input(inputs, lo, hi)
+			inputs++
+			continue
+		}
+
+		var rhs *Expr
+		if r2, ok := inst.p2.isRegister(); ok {
+			rhs = reg[r2]
+		} else {
+			rhs = b.constant(inst.p2.n)
+		}
+
+		e, err := b.binary(exprOps[inst.op], reg[i], rhs)
+		if err != nil {
+			return SymbolicRegisters{}, errors.Wrapf(err, "execution failed on %s", inst.where())
+		}
+		reg[i] = e
+	}
+
+	return SymbolicRegisters{
+		W: reg[0], X: reg[1], Y: reg[2], Z: reg[3],
+		Inputs: inputs,
+	}, nil
+}
+
+// exprOps maps each binary opcode to the equivalent kind of expression.
+var exprOps = map[opcode]ExprOp{
+	opAdd:      ExprAdd,
+	opMultiply: ExprMul,
+	opDivide:   ExprDiv,
+	opModulo:   ExprMod,
+	opEquals:   ExprEql,
+}
+
+// exprBuilder creates expressions, sharing identical nodes.
+type exprBuilder struct {
+	cache map[exprKey]*Expr
+}
+
+// exprKey uniquely identifies an expression node.
+type exprKey struct {
+	op   ExprOp
+	val  int
+	x, y *Expr
+}
+
+func newExprBuilder() *exprBuilder {
+	return &exprBuilder{cache: make(map[exprKey]*Expr, 256)}
+}
+
+// intern returns the shared copy of e.
+func (b *exprBuilder) intern(e Expr) *Expr {
+	key := exprKey{op: e.op, val: e.val, x: e.x, y: e.y}
+	if n, ok := b.cache[key]; ok {
+		return n
+	}
+	n := &e
+	b.cache[key] = n
+	return n
+}
+
+func (b *exprBuilder) constant(n int) *Expr {
+	return b.intern(Expr{op: ExprConst, val: n, lo: n, hi: n})
+}
+
+func (b *exprBuilder) input(i, lo, hi int) *Expr {
+	return b.intern(Expr{op: ExprInput, val: i, lo: lo, hi: hi})
+}
+
+// binary builds the simplest expression that it can find for 'x op y'.
+func (b *exprBuilder) binary(op ExprOp, x, y *Expr) (*Expr, error) {
+	// keep constants on the right of commutative operations:
+	if (op == ExprAdd || op == ExprMul || op == ExprEql) && x.op == ExprConst {
+		x, y = y, x
+	}
+
+	if e, ok, err := b.simplify(op, x, y); ok || err != nil {
+		return e, err
+	}
+
+	// an expression that might fail is kept, even if its value is known,
+	// so that evaluating it fails wherever the ALU would:
+	fails := x.fails || y.fails || mayDivideByZero(op, y)
+	lo, hi := bounds(op, Interval{x.lo, x.hi}, Interval{y.lo, y.hi})
+	if lo == math.MinInt || hi == math.MaxInt {
+		// the bounds saturated, so the result may have overflowed and
+		// wrapped around:
+		lo, hi = fullInterval.Lo, fullInterval.Hi
+	} else if lo == hi && !fails {
+		return b.constant(lo), nil
+	}
+	return b.intern(Expr{op: op, x: x, y: y, lo: lo, hi: hi, fails: fails}), nil
+}
+
+// mayDivideByZero returns true if 'x op y' divides by y, and y might be 0.
+func mayDivideByZero(op ExprOp, y *Expr) bool {
+	return (op == ExprDiv || op == ExprMod) && y.lo <= 0 && 0 <= y.hi
+}
+
+// simplify applies algebraic rules to 'x op y', and returns true if it
+// found an equivalent expression that is simpler. For commutative operations,
+// any constant operand must already be in y. Rules that discard an operand
+// only apply if neither operand might fail.
+func (b *exprBuilder) simplify(op ExprOp, x, y *Expr) (*Expr, bool, error) {
+	if x.op == ExprConst && y.op == ExprConst {
+		n, err := apply(op, x.val, y.val)
+		if err != nil {
+			return nil, false, err
+		}
+		return b.constant(n), true, nil
+	}
+	discard := !x.fails && !y.fails // discard is true if an operand can be dropped.
+
+	switch op {
+	case ExprAdd:
+		if y.IsConst(0) {
+			return x, true, nil
+		}
+		// (a + c1) + c2 = a + (c1 + c2)
+		if y.op == ExprConst && x.op == ExprAdd && x.y.op == ExprConst {
+			e, err := b.binary(ExprAdd, x.x, b.constant(x.y.val+y.val))
+			return e, true, err
+		}
+
+	case ExprMul:
+		if y.IsConst(0) && discard {
+			return y, true, nil
+		}
+		if y.IsConst(1) {
+			return x, true, nil
+		}
+		// (a * c1) * c2 = a * (c1 * c2)
+		if y.op == ExprConst && x.op == ExprMul && x.y.op == ExprConst {
+			e, err := b.binary(ExprMul, x.x, b.constant(x.y.val*y.val))
+			return e, true, err
+		}
+
+	case ExprDiv:
+		if y.IsConst(0) {
+			return nil, false, errors.New("divide by 0")
+		}
+		if y.IsConst(1) {
+			return x, true, nil
+		}
+		// 0 / y = 0, unless y might be 0, when the ALU would fail
+		if x.IsConst(0) && !mayDivideByZero(op, y) && discard {
+			return x, true, nil
+		}
+		if y.op == ExprConst && y.val > 0 && discard {
+			n := y.val
+			// x / n = 0 when 0 <= x < n
+			if 0 <= x.lo && x.hi < n {
+				return b.constant(0), true, nil
+			}
+			// (a * n) / n = a, when a * n cannot overflow
+			if x.op == ExprMul && x.y.IsConst(n) && productFits(x.x, n) {
+				return x.x, true, nil
+			}
+			// (a * n + c) / n = a, when a >= 0 and 0 <= c < n
+			if a, ok := multipleOf(x, n); ok {
+				return a, true, nil
+			}
+		}
+
+	case ExprMod:
+		if y.IsConst(0) {
+			return nil, false, errors.New("modulo of 0 is undefined")
+		}
+		// x % 1 = 0, and 0 % y = 0 unless y might be 0
+		if (y.IsConst(1) || y.IsConst(-1) || x.IsConst(0) && !mayDivideByZero(op, y)) && discard {
+			return b.constant(0), true, nil
+		}
+		if y.op == ExprConst && y.val > 0 && discard {
+			n := y.val
+			// x % n = x when 0 <= x < n
+			if 0 <= x.lo && x.hi < n {
+				return x, true, nil
+			}
+			// (a * n) % n = 0, when a * n cannot overflow
+			if x.op == ExprMul && x.y.IsConst(n) && productFits(x.x, n) {
+				return b.constant(0), true, nil
+			}
+			// (a * n + c) % n = c, when a >= 0 and 0 <= c < n
+			if _, ok := multipleOf(x, n); ok {
+				return x.y, true, nil
+			}
+		}
+
+	case ExprEql:
+		if !discard {
+			break
+		}
+		if x == y {
+			return b.constant(1), true, nil
+		}
+		if x.hi < y.lo || y.hi < x.lo {
+			return b.constant(0), true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// multipleOf checks if x has the form 'a * n + c' where a >= 0 and
+// 0 <= c < n, and neither the product nor the sum can overflow. If so, it
+// returns a.
+func multipleOf(x *Expr, n int) (*Expr, bool) {
+	if x.op != ExprAdd || x.x.op != ExprMul || !x.x.y.IsConst(n) {
+		return nil, false
+	}
+	a, c := x.x.x, x.y
+	if a.lo < 0 || c.lo < 0 || c.hi >= n || !productFits(a, n) {
+		return nil, false
+	}
+	if a.hi*n > math.MaxInt-c.hi {
+		return nil, false
+	}
+	return a, true
+}
+
+// productFits returns true if 'a * n' cannot overflow, for any value of a.
+// The bounds of a are only trustworthy if they are not saturated.
+func productFits(a *Expr, n int) bool {
+	if a.lo == math.MinInt || a.hi == math.MaxInt {
+		return false
+	}
+	_, okLo := mulExact(a.lo, n)
+	_, okHi := mulExact(a.hi, n)
+	return okLo && okHi
+}
+
+// bounds calculates a range of values that 'x op y' is guaranteed to be in.
+func bounds(op ExprOp, x, y Interval) (lo, hi int) {
+	switch op {
+	case ExprAdd:
+		return satAdd(x.Lo, y.Lo), satAdd(x.Hi, y.Hi)
+
+	case ExprMul:
+		return minMax(
+			satMul(x.Lo, y.Lo), satMul(x.Lo, y.Hi),
+			satMul(x.Hi, y.Lo), satMul(x.Hi, y.Hi))
+
+	case ExprDiv:
+		if y.Lo > 0 || y.Hi < 0 {
+			// the divisor never changes sign, so the extremes are at the corners:
+			return minMax(x.Lo/y.Lo, x.Lo/y.Hi, x.Hi/y.Lo, x.Hi/y.Hi)
+		}
+		m := maxAbs(x.Lo, x.Hi)
+		return -m, m
+
+	case ExprMod:
+		m := maxAbs(y.Lo, y.Hi)
+		if m != math.MaxInt {
+			m--
+		}
+		lo, hi = -m, m
+		if x.Lo >= 0 {
+			lo = 0
+		}
+		if x.Hi <= 0 {
+			hi = 0
+		}
+		if x.Lo >= 0 && x.Hi < hi {
+			hi = x.Hi
+		}
+		if x.Hi <= 0 && x.Lo > lo {
+			lo = x.Lo
+		}
+		return lo, hi
+
+	default:
+		return 0, 1
+	}
+}
+
+// satAdd adds two integers, saturating instead of overflowing.
+func satAdd(a, b int) int {
+	sum := a + b
+	switch {
+	case a > 0 && b > 0 && sum < 0:
+		return math.MaxInt
+	case a < 0 && b < 0 && sum >= 0:
+		return math.MinInt
+	default:
+		return sum
+	}
+}
+
+// satMul multiplies two integers, saturating instead of overflowing.
+func satMul(a, b int) int {
+	if prod, ok := mulExact(a, b); ok {
+		return prod
+	}
+	if (a < 0) != (b < 0) {
+		return math.MinInt
+	}
+	return math.MaxInt
+}
+
+// mulExact multiplies two integers, and returns false if the result overflows.
+func mulExact(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	prod := a * b
+	if prod/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return 0, false
+	}
+	return prod, true
+}
+
+// maxAbs returns the largest absolute value of a and b, saturating at MaxInt.
+func maxAbs(a, b int) int {
+	abs := func(n int) int {
+		if n == math.MinInt {
+			return math.MaxInt
+		}
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	if abs(a) > abs(b) {
+		return abs(a)
+	}
+	return abs(b)
+}
+
+// minMax returns the smallest and largest of the given values.
+func minMax(first int, rest ...int) (lo, hi int) {
+	lo, hi = first, first
+	for _, n := range rest {
+		if n < lo {
+			lo = n
+		}
+		if n > hi {
+			hi = n
+		}
+	}
+	return lo, hi
+}
@@ -0,0 +1,233 @@
+package alu
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSymbolic(t *testing.T) {
+	tt := []struct {
+		name    string
+		program string
+		lo, hi  int
+		wantZ   string
+		wantErr bool
+	}{
+		{
+			name:    "constant folding",
+			program: "add z 3\nmul z 4\nadd x 2\nmod z x\nadd z 5\n",
+			lo:      1, hi: 9,
+			wantZ: "5",
+		},
+		{
+			name:    "identities remove no-ops",
+			program: "inp w\nmul x 0\nadd x w\ndiv x 1\nmul x 1\nadd z x\nadd z 0\n",
+			lo:      1, hi: 9,
+			wantZ: "in0",
+		},
+		{
+			name:    "constants move to the right, and are combined",
+			program: "inp w\nadd z 3\nadd z w\nadd z 4\n",
+			lo:      1, hi: 9,
+			wantZ: "(in0 + 7)",
+		},
+		{
+			name:    "ranges decide equality",
+			program: "inp w\nadd x 12\neql x w\nadd z x\n",
+			lo:      1, hi: 9,
+			wantZ: "0",
+		},
+		{
+			name:    "ranges that overlap leave equality symbolic",
+			program: "inp w\nadd x 5\neql x w\nadd z x\n",
+			lo:      1, hi: 9,
+			wantZ: "(in0 == 5)",
+		},
+		{
+			name:    "pushing and popping a base 26 digit",
+			program: "inp w\nadd z w\nmul z 26\ninp y\nadd y 3\nadd z y\nmod z 26\n",
+			lo:      1, hi: 9,
+			wantZ: "(in1 + 3)",
+		},
+		{
+			name:    "dividing a product that overflows",
+			program: "inp w\nmul w 4611686018427387904\ndiv w 4611686018427387904\nadd z w\n",
+			lo:      1, hi: 3,
+			wantZ: "((in0 * 4611686018427387904) / 4611686018427387904)",
+		},
+		{
+			name:    "the remainder of a product that overflows",
+			program: "inp w\nmul w 4611686018427387904\nmod w 3\nadd z w\n",
+			lo:      1, hi: 3,
+			wantZ: "((in0 * 4611686018427387904) % 3)",
+		},
+		{
+			name:    "a multiple plus a remainder that overflows",
+			program: "inp w\nmul w 4611686018427387904\nadd w 1\ndiv w 4611686018427387904\nadd z w\n",
+			lo:      1, hi: 3,
+			wantZ: "(((in0 * 4611686018427387904) + 1) / 4611686018427387904)",
+		},
+		{
+			name:    "dividing 0 by a register that might be 0",
+			program: "inp w\ndiv x w\nadd z x\nmod y w\nadd z y\n",
+			lo:      0, hi: 9,
+			wantZ: "((0 / in0) + (0 % in0))",
+		},
+		{
+			name:    "an expression that might fail is not discarded",
+			program: "inp w\ninp x\ndiv x w\nmul x 0\nadd z x\n",
+			lo:      0, hi: 9,
+			wantZ: "((in1 / in0) * 0)",
+		},
+		{
+			name:    "dividing 0 by a register that is never 0",
+			program: "inp w\ndiv x w\nadd z x\nmod y w\nadd z y\n",
+			lo:      1, hi: 9,
+			wantZ: "0",
+		},
+		{
+			name:    "dividing by a register that is always 0",
+			program: "inp w\ndiv w x\n",
+			lo:      1, hi: 9,
+			wantErr: true,
+		},
+		{
+			name:    "control flow",
+			program: "inp w\ncall f\nf: ret\n",
+			lo:      1, hi: 9,
+			wantErr: true,
+		},
+		{
+			name:    "empty input range",
+			program: "inp w\n",
+			lo:      9, hi: 1,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := require.New(t)
+
+			code, err := Compile([]byte(tc.program))
+			r.NoError(err)
+
+			got, err := RunSymbolic(code, tc.lo, tc.hi)
+			if tc.wantErr {
+				r.Error(err)
+				return
+			}
+			r.NoError(err)
+			assert.Equal(t, tc.wantZ, got.Z.String())
+		})
+	}
+}
+
+func TestExpr_Format(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte("inp w\nadd x w\nmul x 5\nadd y x\nadd y 1\nmul y x\nadd z y\n"))
+	r.NoError(err)
+
+	got, err := RunSymbolic(code, 1, 9)
+	r.NoError(err)
+
+	a.Equal("(((in0 * 5) + 1) * (in0 * 5))", fmt.Sprintf("%v", got.Z))
+	a.Equal("t1 = (in0 * 5)\n((t1 + 1) * t1)", fmt.Sprintf("%+v", got.Z))
+
+	lo, hi := got.Z.Range()
+	a.Equal(6*5, lo)
+	a.Equal(46*45, hi)
+}
+
+// TestRunSymbolic_overflow checks that the simplified expressions still
+// match the ALU when the calculations wrap around.
+func TestRunSymbolic_overflow(t *testing.T) {
+	programs := []string{
+		"inp w\nmul w 4611686018427387904\ndiv w 4611686018427387904\nadd z w\n",
+		"inp w\nmul w 4611686018427387904\nmod w 3\nadd z w\n",
+		"inp w\nmul w 4611686018427387904\nadd w 1\nmod w 4611686018427387904\nadd z w\n",
+		"inp w\nmul w 4611686018427387904\nmod w 5\nadd z w\nadd y -3\neql z y\n",
+	}
+
+	for _, program := range programs {
+		r := require.New(t)
+
+		code, err := Compile([]byte(program))
+		r.NoError(err)
+
+		sym, err := RunSymbolic(code, 1, 3)
+		r.NoError(err)
+
+		for in := 1; in <= 3; in++ {
+			want, err := New(code).Run(Ints(in))
+			r.NoError(err)
+
+			got, err := sym.Z.Eval([]int{in})
+			r.NoError(err)
+			r.Equal(want, got, "%q with input %d", program, in)
+		}
+	}
+}
+
+// TestRunSymbolic_divideByZero checks that an expression fails to evaluate
+// whenever the ALU fails, even if the failing value is discarded.
+func TestRunSymbolic_divideByZero(t *testing.T) {
+	r := require.New(t)
+
+	code, err := Compile([]byte("inp w\ninp x\ndiv x w\nmul x 0\nmod y w\nadd z x\nadd z y\n"))
+	r.NoError(err)
+
+	sym, err := RunSymbolic(code, 0, 2)
+	r.NoError(err)
+
+	for _, in := range [][]int{{0, 1}, {1, 0}, {2, 2}} {
+		want, wantErr := New(code).Run(Ints(in...))
+		got, err := sym.Z.Eval(in)
+		if wantErr != nil {
+			r.Error(err, "input %v", in)
+			continue
+		}
+		r.NoError(err)
+		r.Equal(want, got, "input %v", in)
+	}
+}
+
+// TestRunSymbolic_day24 checks that the symbolic z register of the day 24
+// program agrees with the ALU on random inputs.
+func TestRunSymbolic_day24(t *testing.T) {
+	r := require.New(t)
+
+	src, err := os.ReadFile("../../cmd/day24/input.txt")
+	r.NoError(err)
+
+	code, err := Compile(src)
+	r.NoError(err)
+
+	sym, err := RunSymbolic(code, 1, 9)
+	r.NoError(err)
+	r.Equal(14, sym.Inputs)
+
+	calc := New(code)
+	rng := rand.New(rand.NewSource(24))
+	for i := 0; i < 200; i++ {
+		digits := make([]int, 14)
+		for j := range digits {
+			digits[j] = 1 + rng.Intn(9)
+		}
+
+		want, err := calc.Run(Ints(digits...))
+		r.NoError(err)
+
+		got, err := sym.Z.Eval(digits)
+		r.NoError(err)
+		r.Equal(want, got, "input %v", digits)
+	}
+}
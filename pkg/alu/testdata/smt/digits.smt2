@@ -0,0 +1,96 @@
+; generated by alu.GenerateSMT
+(set-logic QF_NIA)
+(define-fun alu-div ((a Int) (b Int)) Int
+  (ite (= (>= a 0) (>= b 0)) (div (abs a) (abs b)) (- (div (abs a) (abs b)))))
+(define-fun alu-mod ((a Int) (b Int)) Int
+  (- a (* b (alu-div a b))))
+
+(declare-const in0 Int)
+(assert (and (<= 1 in0) (<= in0 9)))
+(declare-const in1 Int)
+(assert (and (<= 1 in1) (<= in1 9)))
+
+(define-fun w0 () Int 0)
+(define-fun x0 () Int 0)
+(define-fun y0 () Int 0)
+(define-fun z0 () Int 0)
+; digits.alu:1: inp w
+(define-fun w1 () Int in0)
+; digits.alu:2: mul x 0
+(define-fun x1 () Int (* x0 0))
+; digits.alu:3: add x z
+(define-fun x2 () Int (+ x1 z0))
+; digits.alu:4: mod x 26
+(define-fun x3 () Int (alu-mod x2 26))
+; digits.alu:5: div z 1
+(define-fun z1 () Int (alu-div z0 1))
+; digits.alu:6: add x 12
+(define-fun x4 () Int (+ x3 12))
+; digits.alu:7: eql x w
+(define-fun x5 () Int (ite (= x4 w1) 1 0))
+; digits.alu:8: eql x 0
+(define-fun x6 () Int (ite (= x5 0) 1 0))
+; digits.alu:9: mul y 0
+(define-fun y1 () Int (* y0 0))
+; digits.alu:10: add y 25
+(define-fun y2 () Int (+ y1 25))
+; digits.alu:11: mul y x
+(define-fun y3 () Int (* y2 x6))
+; digits.alu:12: add y 1
+(define-fun y4 () Int (+ y3 1))
+; digits.alu:13: mul z y
+(define-fun z2 () Int (* z1 y4))
+; digits.alu:14: mul y 0
+(define-fun y5 () Int (* y4 0))
+; digits.alu:15: add y w
+(define-fun y6 () Int (+ y5 w1))
+; digits.alu:16: add y 15
+(define-fun y7 () Int (+ y6 15))
+; digits.alu:17: mul y x
+(define-fun y8 () Int (* y7 x6))
+; digits.alu:18: add z y
+(define-fun z3 () Int (+ z2 y8))
+; digits.alu:19: inp w
+(define-fun w2 () Int in1)
+; digits.alu:20: mul x 0
+(define-fun x7 () Int (* x6 0))
+; digits.alu:21: add x z
+(define-fun x8 () Int (+ x7 z3))
+; digits.alu:22: mod x 26
+(define-fun x9 () Int (alu-mod x8 26))
+; digits.alu:23: div z 1
+(define-fun z4 () Int (alu-div z3 1))
+; digits.alu:24: add x 14
+(define-fun x10 () Int (+ x9 14))
+; digits.alu:25: eql x w
+(define-fun x11 () Int (ite (= x10 w2) 1 0))
+; digits.alu:26: eql x 0
+(define-fun x12 () Int (ite (= x11 0) 1 0))
+; digits.alu:27: mul y 0
+(define-fun y9 () Int (* y8 0))
+; digits.alu:28: add y 25
+(define-fun y10 () Int (+ y9 25))
+; digits.alu:29: mul y x
+(define-fun y11 () Int (* y10 x12))
+; digits.alu:30: add y 1
+(define-fun y12 () Int (+ y11 1))
+; digits.alu:31: mul z y
+(define-fun z5 () Int (* z4 y12))
+; digits.alu:32: mul y 0
+(define-fun y13 () Int (* y12 0))
+; digits.alu:33: add y w
+(define-fun y14 () Int (+ y13 w2))
+; digits.alu:34: add y 12
+(define-fun y15 () Int (+ y14 12))
+; digits.alu:35: mul y x
+(define-fun y16 () Int (* y15 x12))
+; digits.alu:36: add z y
+(define-fun z6 () Int (+ z5 y16))
+
+(define-fun w () Int w2)
+(define-fun x () Int x12)
+(define-fun y () Int y16)
+(define-fun z () Int z6)
+(assert (= z 0))
+(check-sat)
+(get-value (in0 in1))
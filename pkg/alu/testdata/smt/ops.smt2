@@ -0,0 +1,48 @@
+; generated by alu.GenerateSMT
+(set-logic QF_NIA)
+(define-fun alu-div ((a Int) (b Int)) Int
+  (ite (= (>= a 0) (>= b 0)) (div (abs a) (abs b)) (- (div (abs a) (abs b)))))
+(define-fun alu-mod ((a Int) (b Int)) Int
+  (- a (* b (alu-div a b))))
+
+(declare-const in0 Int)
+(assert (and (<= (- 3) in0) (<= in0 3)))
+(declare-const in1 Int)
+(assert (and (<= (- 3) in1) (<= in1 3)))
+
+(define-fun w0 () Int 0)
+(define-fun x0 () Int 0)
+(define-fun y0 () Int 0)
+(define-fun z0 () Int 0)
+; ops.alu:1: inp w
+(define-fun w1 () Int in0)
+; ops.alu:2: inp x
+(define-fun x1 () Int in1)
+; ops.alu:3: add y -7
+(define-fun y1 () Int (+ y0 (- 7)))
+; ops.alu:4: div y x
+(assert (not (= x1 0)))
+(define-fun y2 () Int (alu-div y1 x1))
+; ops.alu:5: mul z w
+(define-fun z1 () Int (* z0 w1))
+; ops.alu:6: add z 3
+(define-fun z2 () Int (+ z1 3))
+; ops.alu:7: mod z x
+(assert (not (= x1 0)))
+(define-fun z3 () Int (alu-mod z2 x1))
+; ops.alu:8: mod y 4
+(define-fun y3 () Int (alu-mod y2 4))
+; ops.alu:9: eql y z
+(define-fun y4 () Int (ite (= y3 z3) 1 0))
+; ops.alu:10: eql w -1
+(define-fun w2 () Int (ite (= w1 (- 1)) 1 0))
+; ops.alu:11: div w 2
+(define-fun w3 () Int (alu-div w2 2))
+
+(define-fun w () Int w3)
+(define-fun x () Int x1)
+(define-fun y () Int y4)
+(define-fun z () Int z3)
+(assert (= y z))
+(check-sat)
+(get-value (in0 in1))
@@ -0,0 +1,296 @@
+package alu
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Tracer receives an event for each instruction that an ALU executes.
+// See SetTracer.
+type Tracer interface {
+	Trace(ev TraceEvent)
+}
+
+// TracerFunc adapts an ordinary function to the Tracer interface.
+type TracerFunc func(ev TraceEvent)
+
+// Trace implements Tracer.
+func (f TracerFunc) Trace(ev TraceEvent) {
+	f(ev)
+}
+
+// TraceEvent describes a single instruction executed by a traced ALU.
+type TraceEvent struct {
+	PC       int // PC is the index of the instruction in the program.
+	Line     int // Line is the source line of the instruction.
+	Before   Registers
+	After    Registers
+	Start    time.Time
+	Duration time.Duration
+	Err      error // Err is the error from the instruction, if it failed.
+
+	inst instruction
+}
+
+// Op returns the name of the instruction's operation, such as "add".
+func (ev TraceEvent) Op() string {
+	return ev.inst.op.String()
+}
+
+// Instruction returns the source code of the instruction, such as "add z 3".
+func (ev TraceEvent) Instruction() string {
+	return ev.inst.String()
+}
+
+// SetTracer makes this ALU send an event to t for every instruction that it
+// executes. Tracing runs each instruction on its own, so it is much slower
+// than running without a tracer. A nil Tracer turns tracing off.
+func (a *ALU) SetTracer(t Tracer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tracer = t
+}
+
+// JSONTracer writes each event as a single line of JSON. Writes are not
+// buffered, so w should usually be a *bufio.Writer.
+type JSONTracer struct {
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONTracer makes a JSONTracer that writes to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+// jsonEvent is the JSON form of a TraceEvent.
+type jsonEvent struct {
+	PC          int       `json:"pc"`
+	Line        int       `json:"line"`
+	Instruction string    `json:"instruction"`
+	Before      Registers `json:"before"`
+	After       Registers `json:"after"`
+	Start       time.Time `json:"start"`
+	Nanoseconds int64     `json:"ns"`
+	Err         string    `json:"error,omitempty"`
+}
+
+// Trace implements Tracer.
+func (t *JSONTracer) Trace(ev TraceEvent) {
+	if t.err != nil {
+		return
+	}
+
+	out := jsonEvent{
+		PC:          ev.PC,
+		Line:        ev.Line,
+		Instruction: ev.Instruction(),
+		Before:      ev.Before,
+		After:       ev.After,
+		Start:       ev.Start,
+		Nanoseconds: ev.Duration.Nanoseconds(),
+	}
+	if ev.Err != nil {
+		out.Err = ev.Err.Error()
+	}
+	t.err = t.enc.Encode(out)
+}
+
+// Err returns the first error from writing an event, if any. The tracer
+// stops writing after an error.
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+// Profile is a Tracer that counts how many times each instruction runs,
+// and how long it takes in total.
+type Profile struct {
+	lines []LineProfile // lines is indexed by the instruction's PC.
+}
+
+// LineProfile is the profile of a single instruction.
+type LineProfile struct {
+	Line        int
+	Instruction string
+	Count       int
+	Total       time.Duration
+}
+
+// Average returns the average time taken by the instruction.
+func (p LineProfile) Average() time.Duration {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.Total / time.Duration(p.Count)
+}
+
+// NewProfile makes an empty profile.
+func NewProfile() *Profile {
+	return &Profile{}
+}
+
+// Trace implements Tracer.
+func (p *Profile) Trace(ev TraceEvent) {
+	for len(p.lines) <= ev.PC {
+		p.lines = append(p.lines, LineProfile{})
+	}
+	lp := &p.lines[ev.PC]
+	if lp.Count == 0 {
+		lp.Line, lp.Instruction = ev.Line, ev.Instruction()
+	}
+	lp.Count++
+	lp.Total += ev.Duration
+}
+
+// Lines returns the profile of each instruction that has run, in program
+// order.
+func (p *Profile) Lines() []LineProfile {
+	var lines []LineProfile
+	for _, lp := range p.lines {
+		if lp.Count > 0 {
+			lines = append(lines, lp)
+		}
+	}
+	return lines
+}
+
+// WriteTo writes the profile as a table, with the instructions that took
+// the most time first. It implements io.WriterTo.
+func (p *Profile) WriteTo(w io.Writer) (int64, error) {
+	lines := p.Lines()
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Total > lines[j].Total
+	})
+
+	cw := &countWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "line\tcount\ttotal\taverage\t\t\n")
+	for _, lp := range lines {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t\t%s\n",
+			lp.Line, lp.Count, lp.Total, lp.Average(), lp.Instruction)
+	}
+	err := tw.Flush()
+	return cw.n, err
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer.
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// ChromeTracer writes each event in the Chrome trace event format, which
+// can be loaded into chrome://tracing or https://ui.perfetto.dev to see the
+// run as a timeline. Times are measured from the first event. Call Close
+// after the last event to finish the JSON array. Writes are not buffered,
+// so w should usually be a *bufio.Writer.
+type ChromeTracer struct {
+	w      io.Writer
+	origin time.Time
+	events int
+	err    error
+}
+
+// NewChromeTracer makes a ChromeTracer that writes to w.
+func NewChromeTracer(w io.Writer) *ChromeTracer {
+	return &ChromeTracer{w: w}
+}
+
+// chromeEvent is a "complete" event, with a start time and a duration,
+// both in microseconds.
+type chromeEvent struct {
+	Name     string     `json:"name"`
+	Category string     `json:"cat"`
+	Phase    string     `json:"ph"`
+	Time     float64    `json:"ts"`
+	Duration float64    `json:"dur"`
+	Process  int        `json:"pid"`
+	Thread   int        `json:"tid"`
+	Args     chromeArgs `json:"args"`
+}
+
+// chromeArgs are shown when an event is selected.
+type chromeArgs struct {
+	Line  int    `json:"line"`
+	PC    int    `json:"pc"`
+	W     int    `json:"w"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Z     int    `json:"z"`
+	Error string `json:"error,omitempty"`
+}
+
+// Trace implements Tracer.
+func (t *ChromeTracer) Trace(ev TraceEvent) {
+	if t.err != nil {
+		return
+	}
+
+	sep := ",\n"
+	if t.events == 0 {
+		t.origin = ev.Start
+		sep = "[\n"
+	}
+	t.events++
+
+	out := chromeEvent{
+		Name:     ev.Instruction(),
+		Category: ev.Op(),
+		Phase:    "X",
+		Time:     microseconds(ev.Start.Sub(t.origin)),
+		Duration: microseconds(ev.Duration),
+		Process:  1,
+		Thread:   1,
+		Args: chromeArgs{
+			Line: ev.Line,
+			PC:   ev.PC,
+			W:    ev.After.W,
+			X:    ev.After.X,
+			Y:    ev.After.Y,
+			Z:    ev.After.Z,
+		},
+	}
+	if ev.Err != nil {
+		out.Args.Error = ev.Err.Error()
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		t.err = err
+		return
+	}
+	if _, err := io.WriteString(t.w, sep); err != nil {
+		t.err = err
+		return
+	}
+	_, t.err = t.w.Write(b)
+}
+
+// Close finishes the trace, and returns the first error from writing it.
+// It does not close the underlying writer.
+func (t *ChromeTracer) Close() error {
+	if t.err != nil {
+		return t.err
+	}
+	end := "\n]\n"
+	if t.events == 0 {
+		end = "[]\n"
+	}
+	_, t.err = io.WriteString(t.w, end)
+	return t.err
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
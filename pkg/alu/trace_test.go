@@ -0,0 +1,169 @@
+package alu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const traceProgram = `inp w
+add z w
+jnz w skip
+mul z 2
+skip: mul z 3
+div z x
+`
+
+func TestSetTracer(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(traceProgram))
+	r.NoError(err)
+
+	var events []TraceEvent
+	calc := New(code)
+	calc.SetTracer(TracerFunc(func(ev TraceEvent) {
+		events = append(events, ev)
+	}))
+
+	_, err = calc.Run(Ints(4))
+	r.EqualError(err, "execution failed on line 6: divide by 0")
+	r.Len(events, 5)
+
+	var lines []int
+	var insts []string
+	for _, ev := range events {
+		lines = append(lines, ev.Line)
+		insts = append(insts, ev.Instruction())
+	}
+	a.Equal([]int{1, 2, 3, 5, 6}, lines)
+	a.Equal([]string{"inp w", "add z w", "jnz w skip", "mul z 3", "div z x"}, insts)
+
+	a.Equal(Registers{W: 4, Z: 4}, events[1].After)
+	a.Equal(events[1].After, events[2].Before)
+	a.Equal("jnz", events[2].Op())
+	a.NoError(events[3].Err)
+	a.EqualError(events[4].Err, "execution failed on line 6: divide by 0")
+
+	// turning the tracer off:
+	calc.SetTracer(nil)
+	_, err = calc.Run(Ints(4))
+	r.Error(err)
+	a.Len(events, 5)
+}
+
+func TestJSONTracer(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(traceProgram))
+	r.NoError(err)
+
+	buf := new(bytes.Buffer)
+	tracer := NewJSONTracer(buf)
+	calc := New(code)
+	calc.SetTracer(tracer)
+	_, err = calc.Run(Ints(0))
+	r.Error(err)
+	r.NoError(tracer.Err())
+
+	s := bufio.NewScanner(buf)
+	var got []jsonEvent
+	for s.Scan() {
+		var ev jsonEvent
+		r.NoError(json.Unmarshal(s.Bytes(), &ev), s.Text())
+		got = append(got, ev)
+	}
+	r.Len(got, 6)
+
+	a.Equal(4, got[4].PC)
+	a.Equal(5, got[4].Line)
+	a.Equal("mul z 3", got[4].Instruction)
+	a.Equal(Registers{}, got[4].After)
+	a.Empty(got[4].Err)
+	a.Equal("execution failed on line 6: divide by 0", got[5].Err)
+}
+
+func TestProfile(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(traceProgram))
+	r.NoError(err)
+
+	prof := NewProfile()
+	calc := New(code)
+	calc.SetTracer(prof)
+	for _, in := range []int{0, 1, 2} {
+		_, err = calc.Run(Ints(in))
+		r.Error(err)
+	}
+
+	var got []LineProfile
+	for _, lp := range prof.Lines() {
+		a.GreaterOrEqual(lp.Total, lp.Average())
+		lp.Total = 0
+		got = append(got, lp)
+	}
+	a.Equal([]LineProfile{
+		{Line: 1, Instruction: "inp w", Count: 3},
+		{Line: 2, Instruction: "add z w", Count: 3},
+		{Line: 3, Instruction: "jnz w skip", Count: 3},
+		{Line: 4, Instruction: "mul z 2", Count: 1},
+		{Line: 5, Instruction: "mul z 3", Count: 3},
+		{Line: 6, Instruction: "div z x", Count: 3},
+	}, got)
+
+	buf := new(strings.Builder)
+	n, err := prof.WriteTo(buf)
+	r.NoError(err)
+	a.Equal(int64(buf.Len()), n)
+
+	table := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	r.Len(table, 7)
+	a.Equal([]string{"line", "count", "total", "average"}, strings.Fields(table[0]))
+	for _, lp := range got {
+		a.Contains(buf.String(), "  "+lp.Instruction+"\n")
+	}
+}
+
+func TestChromeTracer(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	code, err := Compile([]byte(traceProgram))
+	r.NoError(err)
+
+	buf := new(bytes.Buffer)
+	tracer := NewChromeTracer(buf)
+	calc := New(code)
+	calc.SetTracer(tracer)
+	_, err = calc.Run(Ints(3))
+	r.Error(err)
+	r.NoError(tracer.Close())
+
+	var got []chromeEvent
+	r.NoError(json.Unmarshal(buf.Bytes(), &got), buf.String())
+	r.Len(got, 5)
+
+	a.Equal(0.0, got[0].Time)
+	for i, ev := range got {
+		a.Equal("X", ev.Phase)
+		a.GreaterOrEqual(ev.Duration, 0.0)
+		if i > 0 {
+			a.GreaterOrEqual(ev.Time, got[i-1].Time)
+		}
+	}
+	a.Equal("add z w", got[1].Name)
+	a.Equal("add", got[1].Category)
+	a.Equal(chromeArgs{Line: 2, PC: 1, W: 3, Z: 3}, got[1].Args)
+	a.Equal("execution failed on line 6: divide by 0", got[4].Args.Error)
+
+	// an empty trace is still valid JSON:
+	buf.Reset()
+	r.NoError(NewChromeTracer(buf).Close())
+	r.NoError(json.Unmarshal(buf.Bytes(), &got))
+	a.Empty(got)
+}
@@ -4,9 +4,13 @@
 package ast
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"unicode"
 )
 
@@ -18,48 +22,228 @@ type Number interface {
 }
 
 // Tree holds the full Tree for a Number.
+//
+// Trees are persistent: once a tree has been made, none of its nodes ever
+// change, so trees can safely share their subtrees with each other. Add
+// builds its sum on top of the two trees that it adds, and reducing the
+// sum copies only the nodes on the path to each change.
 type Tree struct {
 	// root is a reference to the top node in the tree.
 	root *node
-
-	// infix holds all the nodes in their infix order.
-	// A node's ID is its index in this slice.
-	infix map[int]*node
 }
 
 var _ Number = Tree{}
 
-// Magnitude implements Number.
+// Magnitude implements Number, weighting each pair by DefaultRules.
 func (t Tree) Magnitude() int {
+	return DefaultRules.Magnitude(t)
+}
+
+// Rules are the parameters of snailfish arithmetic. The rules on Day18 are
+// DefaultRules, which Add, Sum and Tree.Magnitude follow; other rules model
+// variants of the puzzle.
+type Rules struct {
+	// ExplodeDepth is how many pairs a pair must be nested inside for it to
+	// explode. It must be at least 1.
+	ExplodeDepth int
+
+	// SplitAbove is the largest regular number that does not split. It must
+	// be at least 1, so that the halves of a split are smaller than the
+	// number that they came from.
+	SplitAbove int
+
+	// SplitRounding says which half of a split gets the extra 1, when the
+	// number that splits is odd.
+	SplitRounding Rounding
+
+	// LeftWeight and RightWeight are the multipliers for the magnitudes of
+	// the left and right elements of a pair.
+	LeftWeight, RightWeight int
+}
+
+// Rounding says which half of an odd number gets the extra 1 when it
+// splits.
+type Rounding int
+
+const (
+	// RoundRight rounds the left half down and the right half up, as on
+	// Day18.
+	RoundRight Rounding = iota
+
+	// RoundLeft rounds the left half up and the right half down.
+	RoundLeft
+)
+
+// DefaultRules are the rules from Day18.
+var DefaultRules = Rules{
+	ExplodeDepth:  4,
+	SplitAbove:    9,
+	SplitRounding: RoundRight,
+	LeftWeight:    3,
+	RightWeight:   2,
+}
+
+// validate checks that reduction under the rules always finishes.
+func (rules Rules) validate() error {
+	if rules.ExplodeDepth < 1 {
+		return fmt.Errorf("invalid explode depth %d: must be at least 1", rules.ExplodeDepth)
+	}
+	if rules.SplitAbove < 1 {
+		return fmt.Errorf("invalid split threshold %d: must be at least 1", rules.SplitAbove)
+	}
+	if rules.SplitRounding != RoundRight && rules.SplitRounding != RoundLeft {
+		return fmt.Errorf("invalid split rounding %d", rules.SplitRounding)
+	}
+	return nil
+}
+
+// Magnitude calculates the magnitude of the tree with the rules' weights.
+// The zero Tree has a magnitude of 0.
+func (rules Rules) Magnitude(t Tree) int {
 	if t.root == nil {
 		return 0
 	}
-	return t.root.Magnitude()
+	return t.root.magnitude(rules)
+}
+
+var (
+	_ fmt.Stringer             = Tree{}
+	_ encoding.TextMarshaler   = Tree{}
+	_ encoding.TextUnmarshaler = (*Tree)(nil)
+	_ json.Marshaler           = Tree{}
+	_ json.Unmarshaler         = (*Tree)(nil)
+)
+
+// String implements fmt.Stringer, returning the number in the same infix
+// notation that New reads, such as "[[1,2],3]". The zero Tree is "0".
+func (t Tree) String() string {
+	if t.root == nil {
+		return "0"
+	}
+	return fmt.Sprintf("%v", t.root)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t Tree) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, by parsing the text
+// with New.
+func (t *Tree) UnmarshalText(text []byte) error {
+	tree, err := New(string(text))
+	if err != nil {
+		return err
+	}
+	*t = *tree
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The infix notation of a number is
+// already valid JSON, so a number is written as nested arrays of integers.
+func (t Tree) MarshalJSON() ([]byte, error) {
+	return t.MarshalText()
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It reads nested arrays of
+// integers, as written by MarshalJSON, or a string holding the infix
+// notation. A JSON null leaves the tree unchanged.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+
+	case len(data) > 0 && data[0] == '"':
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return t.UnmarshalText([]byte(text))
+
+	default:
+		return t.UnmarshalText(data)
+	}
 }
 
 // node is a single element in the tree. Each node is also a Number.
 // a node may be a pair (in which case it will have an operator and two children)
 // or else it will be a leaf node, with just a value.
-// The node's ID is the sequence order this node is encountered during an
-// in-order traversal of the tree.
 // the zero node is a value node with a value of 0.
+// Nodes are immutable once they are part of a tree, since any number of
+// trees might share them; changes are made by building new nodes instead.
 type node struct {
-	id    int    // id is this node's index during an in-order traversal of the tree
 	op    opcode // op specifies this node's type (either opValue or opPair).
 	value int    // if op == opValue, then this holds the node's value
 	left  *node  // if op != opValue, this points to the node's left child.
 	right *node  // if op != opValue, this points the node's right child.
-	depth int    // depth is the number of edges between the root and this node.
+
+	// height and max summarise the subtree, so that reduction can go
+	// straight to the next node to change:
+	height int // height is the number of nested pairs, or 0 for a leaf.
+	max    int // max is the largest value of any leaf in the subtree.
+
+	// owner numbers the reducer that made this node, which is the only
+	// code that may change it, and only while the reduction is in progress.
+	// It is 0 for a node that no reducer made.
+	owner uint64
+}
+
+// leaf makes a new value node.
+func leaf(value int) *node {
+	return &node{value: value, max: value}
+}
+
+// pair makes a new pair node with the given children.
+func pair(left, right *node) *node {
+	n := &node{op: opPair, left: left, right: right}
+	n.summarize()
+	return n
+}
+
+// setChildren sets the children of a pair, and updates its summary. It only
+// writes the pointers that change, since pointer writes are relatively slow
+// while the garbage collector is running.
+func (n *node) setChildren(left, right *node) {
+	if n.left != left {
+		n.left = left
+	}
+	if n.right != right {
+		n.right = right
+	}
+	n.summarize()
+}
+
+// summarize sets the node's height and max from its value or children.
+func (n *node) summarize() {
+	if n.op == opValue {
+		n.height, n.max = 0, n.value
+		return
+	}
+	n.height, n.max = n.left.height, n.left.max
+	if n.right.height > n.height {
+		n.height = n.right.height
+	}
+	if n.right.max > n.max {
+		n.max = n.right.max
+	}
+	n.height++
 }
 
 var _ Number = node{}
 
-// Magnitude implements Number.
+// Magnitude implements Number, weighting each pair by DefaultRules.
 func (n node) Magnitude() int {
+	return n.magnitude(DefaultRules)
+}
+
+// magnitude calculates the magnitude of n, weighting each pair by the
+// rules.
+func (n node) magnitude(rules Rules) int {
 	if n.op == opValue {
 		return n.value
 	}
-	return 3*n.left.Magnitude() + 2*n.right.Magnitude()
+	return rules.LeftWeight*n.left.magnitude(rules) + rules.RightWeight*n.right.magnitude(rules)
 }
 
 // format implements fmt.Formatter to simplify debugging.
@@ -104,14 +288,8 @@ func New(text string) (*Tree, error) {
 		return nil, err
 	}
 
-	t := Tree{
-		infix: make(map[int]*node, len(postfix)),
-	}
-
 	s := stack{}
 	for _, n := range postfix {
-		t.infix[n.id] = n
-
 		if n.op == opValue {
 			s.Push(n)
 			continue
@@ -122,51 +300,58 @@ func New(text string) (*Tree, error) {
 		}
 		right := s.Pop().(*node)
 		left := s.Pop().(*node)
-		n.left, n.right = left, right
-		s.Push(n)
+		s.Push(pair(left, right))
 	}
 
 	if s.Length() != 1 {
 		return nil, errors.New("missing operator")
 	}
 
-	top := s.Pop().(*node)
-	t.root = top
-	t.root.setDepth(0)
-	return &t, nil
+	return &Tree{root: s.Pop().(*node)}, nil
 }
 
 // shuntingYard reads tokens from the infix notation and converts
 // them to postfix notation so that they can more easily be evaluated.
 // Discards whitespace, but otherwise requires all input to be valid.
-// Assumes all numeric inputs are a single digit.
-// The returned nodes will have their id, value, and operator defined, but
-// pairs won't have their left and right children pointers set yet. Therefore,
-// this function should really only be called from within New() which adds the
-// child pointers, making the tree useful.
+// Literals are decimal integers, which may be negative or have more than
+// one digit, and each pair of brackets must hold exactly one pair.
+// The returned pairs only mark where each pair goes: they don't have any
+// children. Therefore, this function should really only be called from
+// within New(), which builds the pairs, making the tree useful.
 func shuntingYard(infix string) (postfix []*node, err error) {
 	// reverse polish notation
 	rpn := make([]*node, 0, 64)
 	s := stack{}
 
-	var nextID int
+	end := 0 // end is the index just after the last literal.
 
 	for i, token := range infix {
+		if i < end {
+			// this is part of a literal that has already been read
+			continue
+		}
+
 		switch token {
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-			rpn = append(rpn, &node{id: nextID, value: int(token - '0')})
-			nextID++
+		case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			end = i + 1
+			for end < len(infix) && '0' <= infix[end] && infix[end] <= '9' {
+				end++
+			}
+			value, err := strconv.Atoi(infix[i:end])
+			if err != nil {
+				return nil, fmt.Errorf("index %d: invalid number %q", i, infix[i:end])
+			}
+			rpn = append(rpn, leaf(value))
 
 		case ',':
-			s.Push(&node{id: nextID, op: opPair})
-			nextID++
+			s.Push(&node{op: opPair})
 
 		case '[':
-			// brackets don't get any ID - they will be discarded
+			// brackets will be discarded
 			s.Push(&node{op: opGroupStart})
 
 		case ']':
-			done := false
+			done, pairs := false, 0
 			for !done && s.Length() > 0 {
 				top := s.Pop().(*node)
 				if top.op == opGroupStart {
@@ -174,10 +359,14 @@ func shuntingYard(infix string) (postfix []*node, err error) {
 					break
 				}
 				rpn = append(rpn, top)
+				pairs++
 			}
 			if !done {
 				return nil, fmt.Errorf("index %d: mismatched closing bracket", i)
 			}
+			if pairs != 1 {
+				return nil, fmt.Errorf("index %d: brackets must hold exactly one pair", i)
+			}
 
 		default:
 			if unicode.IsSpace(token) {
@@ -199,14 +388,22 @@ func shuntingYard(infix string) (postfix []*node, err error) {
 // the results of each addition. The input parameters will be unaffected by the
 // addition.
 func Sum(numbers ...*Tree) (sum *Tree, err error) {
+	return DefaultRules.Sum(numbers...)
+}
+
+// Sum is like the package-level Sum, but reduces each addition with these
+// rules.
+func (rules Rules) Sum(numbers ...*Tree) (sum *Tree, err error) {
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
 	if len(numbers) == 0 {
-		zero := &node{}
-		return &Tree{root: zero, infix: map[int]*node{0: zero}}, nil
+		return &Tree{root: leaf(0)}, nil
 	}
 
 	sum = numbers[0]
 	for i := 1; i < len(numbers); i++ {
-		sum, err = Add(*sum, *numbers[i])
+		sum, err = rules.Add(*sum, *numbers[i])
 		if err != nil {
 			return nil, err
 		}
@@ -215,19 +412,33 @@ func Sum(numbers ...*Tree) (sum *Tree, err error) {
 }
 
 // Add trees a and b, returning a pointer to their sum, which is reduced.
-// Trees a and b are unaffected.
+// Trees a and b are unaffected, and the sum shares every part of them that
+// reduction leaves unchanged. The zero Tree is treated as 0.
 func Add(a, b Tree) (*Tree, error) {
-	sum := fmt.Sprintf("[%v,%v]", a.root, b.root)
-	t, err := New(sum)
-	if err != nil {
+	return DefaultRules.Add(a, b)
+}
+
+// Add is like the package-level Add, but reduces the sum with these rules.
+func (rules Rules) Add(a, b Tree) (*Tree, error) {
+	if err := rules.validate(); err != nil {
 		return nil, err
 	}
+	t := Tree{root: pair(a.rootOrZero(), b.rootOrZero())}
+	t.reduce(rules)
+	return &t, nil
+}
 
-	t.reduce()
-	return t, nil
+// rootOrZero returns the tree's root, or a 0 leaf for the zero Tree.
+func (t Tree) rootOrZero() *node {
+	if t.root == nil {
+		return leaf(0)
+	}
+	return t.root
 }
 
-// reduce adjusts is tree following the rules from Day18:
+// reduce adjusts the tree following the rules from Day18, with the limits
+// given by rules.
+//
 // To reduce a snailfish number, you must repeatedly do the first action in
 // this list that applies to the snailfish number:
 //
@@ -238,169 +449,188 @@ func Add(a, b Tree) (*Tree, error) {
 // During reduction, at most one action applies, after which the process returns
 // to the top of the list of actions. For example, if split produces a pair that
 // meets the explode criteria, that pair explodes before other splits occur.
-func (t *Tree) reduce() bool {
-	changed := false
+//
+// reduce replaces the tree's root, rather than changing any node that
+// another tree might share.
+func (t *Tree) reduce(rules Rules) bool {
+	r := newReducer(rules)
+	t.root = r.reduce(t.root)
+	return r.steps > 0
+}
+
+// reducers counts the reducers made so far, to number each one.
+var reducers uint64
+
+// reducer reduces a single tree.
+//
+// Each action takes time in proportion to the depth of the tree, rather
+// than its size, since explode and split use the summary in each node to go
+// straight to the node that they change, and to the leaves next to it.
+//
+// The nodes that a reducer makes are its own, so it changes them in place,
+// but it copies any other node before changing it, since other trees might
+// share it. That way, each shared node is copied at most once, however many
+// actions change it. Once the reduction is done, nothing can change the
+// reducer's nodes any more. The nodes only hold the reducer's number, so
+// the finished tree does not keep the reducer alive.
+type reducer struct {
+	id    uint64  // id is the number that marks the reducer's own nodes.
+	rules Rules   // rules sets when pairs explode and leaves split.
+	steps int     // steps counts the actions taken so far.
+	free  []*node // free holds the reducer's own leaves that explode dropped.
+}
+
+// newReducer makes a reducer with a number that no other reducer has.
+func newReducer(rules Rules) *reducer {
+	return &reducer{id: atomic.AddUint64(&reducers, 1), rules: rules}
+}
+
+// reduce returns the reduced form of n.
+func (r *reducer) reduce(n *node) *node {
 	for {
-		t.root.setDepth(0)
-		if tooDeep := t.firstDepth4(); tooDeep != nil {
-			t.explode(tooDeep)
-			changed = true
+		if out, _, _, ok := r.explode(n, 0); ok {
+			n = out
+			r.steps++
 			continue
 		}
 
-		tooBig := t.firstOver9()
-		if tooBig == nil {
-			break
+		out, ok := r.split(n)
+		if !ok {
+			return n
 		}
-		t.split(tooBig)
-		changed = true
+		n = out
+		r.steps++
 	}
-	return changed
 }
 
-// firstDepth4 finds the left-most pair that is nested inside four pairs.
-// Returns nil if there is no such pair.
-func (t *Tree) firstDepth4() *node {
-	for i := 0; i < len(t.infix); i++ {
-		if n, ok := t.infix[i]; ok && n.op == opPair && n.depth == 4 {
-			return n
-		}
+// own returns n, if it belongs to this reducer, or else a copy of n which
+// does, so that it can be changed.
+func (r *reducer) own(n *node) *node {
+	if n.owner == r.id {
+		return n
 	}
-	return nil
+	m := *n
+	m.owner = r.id
+	return &m
 }
 
-// firstOver9 finds the if of the left-most leaf that is 10 or greater.
-// Returns nil if there is no such leaf.
-func (t *Tree) firstOver9() *node {
-	for i := 0; i < len(t.infix); i++ {
-		if n, ok := t.infix[i]; ok && n.op == opValue && n.value > 9 {
-			return n
-		}
+// leaf makes a new value node that belongs to this reducer, reusing a
+// dropped leaf if there is one.
+func (r *reducer) leaf(value int) *node {
+	if k := len(r.free); k > 0 {
+		n := r.free[k-1]
+		r.free = r.free[:k-1]
+		n.value, n.max = value, value
+		return n
 	}
-	return nil
+	return &node{value: value, max: value, owner: r.id}
 }
 
-// explode the given node, as per the rules on Day18.
-// Panics if the given id is not in the tree, or is not a pair.
-// Assumes the pair has two value children (which it will, if the rules of
-// fish math have been followed.)
-func (t *Tree) explode(n *node) {
-	if n.op != opPair {
-		panic(fmt.Errorf("tring to explode a leaf node: %d", n.id))
+// drop frees a leaf that is no longer part of the tree, if it belongs to
+// this reducer. Nothing else can refer to such a leaf, since the reducer's
+// own nodes are only ever part of the tree that it is reducing.
+func (r *reducer) drop(n *node) {
+	if n.owner == r.id {
+		r.free = append(r.free, n)
 	}
+}
 
-	if n.left.op != opValue || n.right.op != opValue {
-		panic(fmt.Errorf("trying to explode a pair with a child pair: %d", n.id))
+// explode finds the left-most pair of two regular numbers that is nested
+// inside r.rules.ExplodeDepth pairs, where n is nested inside depth pairs,
+// and explodes it, as per the rules on Day18. It returns the node to use in
+// place of n, and the values of the exploded pair that still need to be
+// added to the leaves on its left and right, outside of n. If there is
+// nothing to explode, it returns n and false.
+func (r *reducer) explode(n *node, depth int) (out *node, left, right int, ok bool) {
+	if depth+n.height <= r.rules.ExplodeDepth {
+		// no pair inside n is nested deeply enough to explode; otherwise,
+		// the deepest such pair would be a pair of regular numbers that
+		// explodes, so a search inside n never has to backtrack.
+		return n, 0, 0, false
 	}
 
-	if t.infix[n.left.id] != n.left {
-		panic(fmt.Errorf("left id and left child do not match"))
+	if depth >= r.rules.ExplodeDepth && n.left.op == opValue && n.right.op == opValue {
+		left, right = n.left.value, n.right.value
+		r.drop(n.left)
+		r.drop(n.right)
+		out = r.own(n)
+		out.op, out.value, out.left, out.right = opValue, 0, nil, nil
+		out.summarize()
+		return out, left, right, true
 	}
 
-	if t.infix[n.right.id] != n.right {
-		panic(fmt.Errorf("right id and right child do not match"))
+	if l, left, right, ok := r.explode(n.left, depth+1); ok {
+		out = r.own(n)
+		out.setChildren(l, r.addLeftmost(out.right, right))
+		return out, left, 0, true
 	}
 
-	if t.infix[n.id] != n {
-		panic(fmt.Errorf("self id and self do not match"))
+	if rt, left, right, ok := r.explode(n.right, depth+1); ok {
+		out = r.own(n)
+		out.setChildren(r.addRightmost(out.left, left), rt)
+		return out, 0, right, true
 	}
 
-	// add this node's left child to the leaf that's just to the left
-	if leaf := t.findLeafLeftOf(n.id - 1); leaf != nil {
-		leaf.value += n.left.value
-	}
+	return n, 0, 0, false
+}
 
-	// add this node's right child to the leaf that's just to the right
-	if leaf := t.findLeafRightOf(n.id + 1); leaf != nil {
-		leaf.value += n.right.value
+// addLeftmost returns n with v added to its left-most leaf.
+func (r *reducer) addLeftmost(n *node, v int) *node {
+	if v == 0 {
+		return n
 	}
-
-	// set this node to zero, and prevent memory leaks
-	n.op, n.value = opValue, 0
-	n.left, n.right = nil, nil
-
-	// fix this node's ID
-	n.id -= 1
-	t.infix[n.id] = n
-
-	// fix IDs of nodes to the right of this one
-	lastID := len(t.infix) - 3
-	for i := n.id + 1; i <= lastID; i++ {
-		n, ok := t.infix[i+2]
-		if !ok {
-			panic(fmt.Errorf("something is wrong with index %d", i+2))
-		}
-		n.id = i
-		t.infix[n.id] = n
+	out := r.own(n)
+	if out.op == opValue {
+		out.value += v
+		out.summarize()
+	} else {
+		out.setChildren(r.addLeftmost(out.left, v), out.right)
 	}
-
-	delete(t.infix, lastID+1)
-	delete(t.infix, lastID+2)
+	return out
 }
 
-// split divides the value of a leaf node in half, converting that leaf
-// to a pair, with one half of the value in each child.
-func (t *Tree) split(n *node) {
-	if n.op != opValue {
-		panic(fmt.Errorf("trying to split a non-leaf node: %v", n))
+// addRightmost returns n with v added to its right-most leaf.
+func (r *reducer) addRightmost(n *node, v int) *node {
+	if v == 0 {
+		return n
 	}
-
-	if t.infix[n.id] != n {
-		panic(fmt.Errorf("self id and self do not match"))
+	out := r.own(n)
+	if out.op == opValue {
+		out.value += v
+		out.summarize()
+	} else {
+		out.setChildren(out.left, r.addRightmost(out.right, v))
 	}
-
-	// create child nodes (no IDs yet)
-	half, rem := n.value/2, n.value%2
-	n.op, n.value = opPair, 0
-	n.left = &node{value: half, depth: n.depth + 1}
-	n.right = &node{value: half + rem, depth: n.depth + 1}
-
-	// shuffle ids for nodes to the right of this pair right by two:
-	lastID := len(t.infix) - 1
-	for id := lastID; id > n.id; id-- {
-		nn := t.infix[id]
-		nn.id += 2
-		t.infix[nn.id] = nn
-	}
-
-	// this node's id increases by one
-	n.id += 1
-	t.infix[n.id] = n
-
-	// insert children to map (child IDs were set above)
-	n.left.id = n.id - 1
-	n.right.id = n.id + 1
-	t.infix[n.left.id] = n.left
-	t.infix[n.right.id] = n.right
+	return out
 }
 
-// findLeafLeftOf finds the next leaf to the left of the given id.
-func (t Tree) findLeafLeftOf(id int) *node {
-	for id -= 1; id >= 0; id-- {
-		if n, ok := t.infix[id]; ok && n.op == opValue {
-			return n
-		}
+// split finds the left-most leaf that is greater than r.rules.SplitAbove,
+// and divides its value in half, converting that leaf to a pair, with one
+// half of the value in each child, rounded as the rules say. It returns the
+// node to use in place of n, and true, or else n and false if there is
+// nothing to split.
+func (r *reducer) split(n *node) (*node, bool) {
+	if n.max <= r.rules.SplitAbove {
+		return n, false
 	}
-	return nil
-}
 
-// findLeafRightOf finds the next leaf to the right of the given id.
-func (t Tree) findLeafRightOf(id int) *node {
-	for id += 1; id < len(t.infix); id++ {
-		if n, ok := t.infix[id]; ok && n.op == opValue {
-			return n
+	out := r.own(n)
+	switch {
+	case out.op == opValue:
+		left, right := out.value/2, out.value-out.value/2
+		if r.rules.SplitRounding == RoundLeft {
+			left, right = right, left
 		}
-	}
-	return nil
-}
+		out.op, out.value = opPair, 0
+		out.setChildren(r.leaf(left), r.leaf(right))
 
-// setDepth recursively sets the depth of this node and its children.
-func (n *node) setDepth(d int) {
-	n.depth = d
-	if n.left != nil {
-		n.left.setDepth(d + 1)
-	}
-	if n.right != nil {
-		n.right.setDepth(d + 1)
+	case out.left.max > r.rules.SplitAbove:
+		l, _ := r.split(out.left)
+		out.setChildren(l, out.right)
+
+	default:
+		rt, _ := r.split(out.right)
+		out.setChildren(out.left, rt)
 	}
+	return out, true
 }
@@ -1,7 +1,11 @@
 package ast
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,11 +23,11 @@ var examples = []struct {
 		name:    "example 1",
 		infix:   "[[1,3],[[5,7],9]]",
 		postfix: "13+57+9++",
-		root: pair(3, 0,
-			pair(1, 1, &node{id: 0, value: 1}, &node{id: 2, value: 3}),
-			pair(7, 1,
-				pair(5, 2, &node{id: 4, value: 5}, &node{id: 6, value: 7}),
-				&node{id: 8, depth: 2, value: 9},
+		root: pair(
+			pair(leaf(1), leaf(3)),
+			pair(
+				pair(leaf(5), leaf(7)),
+				leaf(9),
 			),
 		),
 		magnitude: 237,
@@ -35,25 +39,25 @@ var examples = []struct {
 			[[[7,7],[7,7]],[[7,8],[9,9]]]
 		]`,
 		postfix: "66+76++77+70+++77+77++78+99++++",
-		root: pair(15, 0,
-			pair(7, 1,
-				pair(3, 2,
-					pair(1, 3, &node{id: 0, value: 6}, &node{id: 2, value: 6}),
-					pair(5, 3, &node{id: 4, value: 7}, &node{id: 6, value: 6}),
+		root: pair(
+			pair(
+				pair(
+					pair(leaf(6), leaf(6)),
+					pair(leaf(7), leaf(6)),
 				),
-				pair(11, 2,
-					pair(9, 3, &node{id: 8, value: 7}, &node{id: 10, value: 7}),
-					pair(13, 3, &node{id: 12, value: 7}, &node{id: 14, value: 0}),
+				pair(
+					pair(leaf(7), leaf(7)),
+					pair(leaf(7), leaf(0)),
 				),
 			),
-			pair(23, 1,
-				pair(19, 2,
-					pair(17, 3, &node{id: 16, value: 7}, &node{id: 18, value: 7}),
-					pair(21, 3, &node{id: 20, value: 7}, &node{id: 22, value: 7}),
+			pair(
+				pair(
+					pair(leaf(7), leaf(7)),
+					pair(leaf(7), leaf(7)),
 				),
-				pair(27, 2,
-					pair(25, 3, &node{id: 24, value: 7}, &node{id: 26, value: 8}),
-					pair(29, 3, &node{id: 28, value: 9}, &node{id: 30, value: 9}),
+				pair(
+					pair(leaf(7), leaf(8)),
+					pair(leaf(9), leaf(9)),
 				),
 			),
 		),
@@ -79,6 +83,97 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_literals(t *testing.T) {
+	tt := []struct {
+		name      string
+		infix     string
+		want      *node
+		magnitude int
+	}{
+		{
+			name:      "a single literal",
+			infix:     "123",
+			want:      leaf(123),
+			magnitude: 123,
+		},
+		{
+			name:      "multi-digit literals",
+			infix:     "[[10,2],345]",
+			want:      pair(pair(leaf(10), leaf(2)), leaf(345)),
+			magnitude: 3*(3*10+2*2) + 2*345,
+		},
+		{
+			name:      "negative literals",
+			infix:     "[ -7 , [-12,0] ]",
+			want:      pair(leaf(-7), pair(leaf(-12), leaf(0))),
+			magnitude: 3*-7 + 2*(3*-12),
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, a := require.New(t), assert.New(t)
+
+			got, err := New(tc.infix)
+			r.NoError(err)
+			a.Equal(tc.want, got.root)
+			a.Equal(tc.magnitude, got.Magnitude())
+		})
+	}
+}
+
+func TestTree_text(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	tree, err := New("[ [10, -2], 3 ]")
+	r.NoError(err)
+	a.Equal("[[10,-2],3]", tree.String())
+	a.Equal("[[10,-2],3]", fmt.Sprint(tree))
+	a.Equal("0", Tree{}.String())
+
+	text, err := tree.MarshalText()
+	r.NoError(err)
+
+	var got Tree
+	r.NoError(got.UnmarshalText(text))
+	a.Equal(tree.root, got.root)
+
+	a.Error(got.UnmarshalText([]byte("[1,")))
+}
+
+func TestTree_JSON(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	type homework struct {
+		Numbers []Tree `json:"numbers"`
+		Sum     *Tree  `json:"sum"`
+	}
+
+	first, err := New("[[1,2],3]")
+	r.NoError(err)
+	second, err := New("[12,[-4,5]]")
+	r.NoError(err)
+
+	data, err := json.Marshal(homework{Numbers: []Tree{*first, *second}})
+	r.NoError(err)
+	a.Equal(`{"numbers":[[[1,2],3],[12,[-4,5]]],"sum":null}`, string(data))
+
+	var got homework
+	r.NoError(json.Unmarshal(data, &got))
+	r.Len(got.Numbers, 2)
+	a.Equal(first.root, got.Numbers[0].root)
+	a.Equal(second.root, got.Numbers[1].root)
+	a.Nil(got.Sum)
+
+	// the infix notation can also be given as a string:
+	r.NoError(json.Unmarshal([]byte(`{"numbers":["[ 7, [8,9] ]"]}`), &got))
+	a.Equal("[7,[8,9]]", got.Numbers[0].String())
+
+	a.Error(json.Unmarshal([]byte(`{"numbers":[[1,2,3]]}`), &got))
+}
+
 func TestErrorHandling(t *testing.T) {
 	tt := []struct {
 		name  string
@@ -89,6 +184,11 @@ func TestErrorHandling(t *testing.T) {
 		{"Missing right-hand child", "[2,[]]"},
 		{"Unexpected symbol", "[2,a]"},
 		{"Missing operator", "[22]"},
+		{"Brackets around a literal", "[[22],3]"},
+		{"Brackets around a pair", "[[[1,2]],3]"},
+		{"Three items in a pair", "[1,2,3]"},
+		{"Minus sign without digits", "[-,2]"},
+		{"Literal out of range", "[99999999999999999999,2]"},
 	}
 
 	for _, tc := range tt {
@@ -102,36 +202,69 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestAdd_persistent(t *testing.T) {
+	r, a := require.New(t), assert.New(t)
+
+	x, err := New("[[1,2],[3,4]]")
+	r.NoError(err)
+	y, err := New("[[[[5,5],1],2],3]")
+	r.NoError(err)
+
+	sum, err := Add(*x, *y)
+	r.NoError(err)
+	a.Equal("[[[1,2],[3,9]],[[[0,6],2],3]]", sum.String())
+
+	// the inputs are unchanged:
+	a.Equal("[[1,2],[3,4]]", x.String())
+	a.Equal("[[[[5,5],1],2],3]", y.String())
+
+	// the sum shares the subtrees that reduction left alone, and copies
+	// the paths to the leaves that changed:
+	a.Same(x.root.left, sum.root.left.left)
+	a.NotSame(x.root.right, sum.root.left.right)
+	a.Same(y.root.right, sum.root.right.right)
+
+	// a tree can even be added to itself:
+	double, err := Add(*sum, *sum)
+	r.NoError(err)
+	a.Equal("[[[1,2],[3,9]],[[[0,6],2],3]]", sum.String())
+	want, err := Add(*mustNew(t, sum.String()), *mustNew(t, sum.String()))
+	r.NoError(err)
+	a.Equal(want.String(), double.String())
+}
+
+func mustNew(t *testing.T, infix string) *Tree {
+	t.Helper()
+	tree, err := New(infix)
+	require.NoError(t, err)
+	return tree
+}
+
 func TestExplode(t *testing.T) {
 	tt := []struct {
-		name  string
-		in    string
-		index int
-		want  string
+		name string
+		in   string
+		want string
 	}{
 		{
-			name:  "left-most node (id = 1)",
-			in:    "[[[[[9,8],1],2],3],4]",
-			index: 1,
-			want:  "[[[[0,9],2],3],4]",
+			name: "left-most node",
+			in:   "[[[[[9,8],1],2],3],4]",
+			want: "[[[[0,9],2],3],4]",
 		},
 		{
-			name:  "a middle node (id = 5)",
-			in:    "[4,[[3,[[7,9],6]],8]]",
-			index: 5,
-			want:  "[4,[[10,[0,15]],8]]",
+			name: "a middle node",
+			in:   "[4,[[3,[[7,9],6]],8]]",
+			want: "[4,[[10,[0,15]],8]]",
 		},
 		{
-			name:  "a right-most node (id = 9)",
-			in:    "[7,[6,[5,[4,[3,2]]]]]",
-			index: 9,
-			want:  "[7,[6,[5,[7,0]]]]",
+			name: "a right-most node",
+			in:   "[7,[6,[5,[4,[3,2]]]]]",
+			want: "[7,[6,[5,[7,0]]]]",
 		},
 		{
-			name:  "right node in a large left subtree (id = 7)",
-			in:    "[[3,[2,[1,[7,3]]]],[6,[5,[4,[3,2]]]]]",
-			index: 7,
-			want:  "[[3,[2,[8,0]]],[9,[5,[4,[3,2]]]]]",
+			name: "right node in a large left subtree",
+			in:   "[[3,[2,[1,[7,3]]]],[6,[5,[4,[3,2]]]]]",
+			want: "[[3,[2,[8,0]]],[9,[5,[4,[3,2]]]]]",
 		},
 	}
 
@@ -142,12 +275,12 @@ func TestExplode(t *testing.T) {
 			tree, err := New(tc.in)
 			r.NoError(err)
 
-			tree.explode(tree.infix[tc.index])
+			root, _, _, ok := newReducer(DefaultRules).explode(tree.root, 0)
+			r.True(ok)
 
-			// in some cases, the 'want' string will not be valid for parsing,
-			// because some numbers will be > 9
-			// so we compare the string output instead.
-			a.Equal(tc.want, fmt.Sprintf("%v", tree.root))
+			// in some cases, the 'want' string has numbers > 9, which
+			// reduction would split, so we compare the string output instead.
+			a.Equal(tc.want, fmt.Sprintf("%v", root))
 		})
 	}
 }
@@ -168,6 +301,11 @@ func TestReduce(t *testing.T) {
 			"[[[[[1,1],[2,2]],[3,3]],[4,4]],[5,5]]",
 			"[[[[3,0],[5,3]],[4,4]],[5,5]]",
 		},
+		{
+			"unreduced literals",
+			"[[10,2],23]",
+			"[[[5,5],2],[[5,6],[6,6]]]",
+		},
 	}
 
 	for _, tc := range tt {
@@ -178,19 +316,258 @@ func TestReduce(t *testing.T) {
 			tree, err := New(tc.in)
 			r.NoError(err)
 
-			tree.reduce()
+			tree.reduce(DefaultRules)
 
 			want, err := New(tc.want)
 			r.NoError(err)
 
-			a.Equal(want.root, tree.root)
+			a.Equal(want.String(), tree.String())
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	shallow := DefaultRules
+	shallow.ExplodeDepth = 2
+
+	low := DefaultRules
+	low.SplitAbove = 4
+
+	roundLeft := low
+	roundLeft.SplitRounding = RoundLeft
+
+	weighted := DefaultRules
+	weighted.LeftWeight, weighted.RightWeight = 1, 10
+
+	tt := []struct {
+		name      string
+		rules     Rules
+		a, b      string
+		want      string
+		magnitude int
+	}{
+		{
+			name:      "default rules",
+			rules:     DefaultRules,
+			a:         "[[[[4,3],4],4],[7,[[8,4],9]]]",
+			b:         "[1,1]",
+			want:      "[[[[0,7],4],[[7,8],[6,0]]],[8,1]]",
+			magnitude: 1384,
+		},
+		{
+			name:      "explode inside two pairs",
+			rules:     shallow,
+			a:         "[[1,2],3]",
+			b:         "[4,5]",
+			want:      "[[0,5],[4,5]]",
+			magnitude: 74,
+		},
+		{
+			name:      "split above 4",
+			rules:     low,
+			a:         "5",
+			b:         "1",
+			want:      "[[2,3],1]",
+			magnitude: 38,
+		},
+		{
+			name:      "split rounding the left half up",
+			rules:     roundLeft,
+			a:         "5",
+			b:         "1",
+			want:      "[[3,2],1]",
+			magnitude: 41,
+		},
+		{
+			name:      "magnitude weights",
+			rules:     weighted,
+			a:         "[0,5]",
+			b:         "[4,5]",
+			want:      "[[0,5],[4,5]]",
+			magnitude: 590,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, a := require.New(t), assert.New(t)
+
+			sum, err := tc.rules.Sum(mustNew(t, tc.a), mustNew(t, tc.b))
+			r.NoError(err)
+			a.Equal(tc.want, sum.String())
+			a.Equal(tc.magnitude, tc.rules.Magnitude(*sum))
+		})
+	}
+}
+
+func TestRules_invalid(t *testing.T) {
+	tt := []struct {
+		name  string
+		rules func(*Rules)
+	}{
+		{"zero explode depth", func(r *Rules) { r.ExplodeDepth = 0 }},
+		{"zero split threshold", func(r *Rules) { r.SplitAbove = 0 }},
+		{"unknown rounding", func(r *Rules) { r.SplitRounding = 2 }},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rules := DefaultRules
+			tc.rules(&rules)
+
+			_, err := rules.Add(Tree{}, Tree{})
+			assert.Error(t, err)
+			_, err = rules.Sum()
+			assert.Error(t, err)
 		})
 	}
 }
 
-// pair is a utility function to create a pointer to a pair of nodes.
-func pair(id, depth int, left, right *node) *node {
-	left.depth = depth + 1
-	right.depth = depth + 1
-	return &node{id: id, depth: depth, op: opPair, left: left, right: right}
+// TestReduce_flat checks reduce against a simple reference, which keeps the
+// leaves in a flat list and scans it for every action, over sums of many
+// random numbers.
+func TestReduce_flat(t *testing.T) {
+	rng := rand.New(rand.NewSource(18))
+	for i := 0; i < 200; i++ {
+		checkFlat(t, rng, DefaultRules)
+	}
+}
+
+// TestRules_flat checks reduction against the same reference, with random
+// rules other than the ones from Day18.
+func TestRules_flat(t *testing.T) {
+	rng := rand.New(rand.NewSource(25))
+	for i := 0; i < 200; i++ {
+		rules := Rules{
+			ExplodeDepth:  1 + rng.Intn(6),
+			SplitAbove:    1 + rng.Intn(20),
+			SplitRounding: Rounding(rng.Intn(2)),
+		}
+		checkFlat(t, rng, rules)
+	}
+}
+
+// checkFlat adds two random numbers, which are reduced under the rules, and
+// checks the sum against reduceFlat.
+func checkFlat(t *testing.T, rng *rand.Rand, rules Rules) {
+	t.Helper()
+	a, b := randomTree(rng, rules, 0), randomTree(rng, rules, 0)
+
+	got, err := rules.Add(*mustNew(t, a), *mustNew(t, b))
+	require.NoError(t, err)
+
+	want := unflatten(reduceFlat(flatten(mustNew(t, "["+a+","+b+"]").root, 0), rules))
+	require.Equal(t, want.String(), got.String(), "%+v: %s + %s", rules, a, b)
+}
+
+// randomTree makes a random number, which is reduced under the rules, at
+// the given depth.
+func randomTree(rng *rand.Rand, rules Rules, depth int) string {
+	if depth == rules.ExplodeDepth || depth > 0 && rng.Intn(3) == 0 {
+		return fmt.Sprint(rng.Intn(rules.SplitAbove + 1))
+	}
+	return "[" + randomTree(rng, rules, depth+1) + "," + randomTree(rng, rules, depth+1) + "]"
+}
+
+// flatLeaf is a leaf in the flat form of a tree, which lists the leaves in
+// order, each with the number of pairs that it is nested inside.
+type flatLeaf struct {
+	value, depth int
+}
+
+func flatten(n *node, depth int) []flatLeaf {
+	if n.op == opValue {
+		return []flatLeaf{{n.value, depth}}
+	}
+	return append(flatten(n.left, depth+1), flatten(n.right, depth+1)...)
+}
+
+func unflatten(leaves []flatLeaf) Tree {
+	var build func(depth int) *node
+	build = func(depth int) *node {
+		if leaves[0].depth == depth {
+			n := leaf(leaves[0].value)
+			leaves = leaves[1:]
+			return n
+		}
+		return pair(build(depth+1), build(depth+1))
+	}
+	return Tree{root: build(0)}
+}
+
+// reduceFlat reduces the sum of two reduced numbers in flat form, scanning
+// the whole list for each action.
+func reduceFlat(leaves []flatLeaf, rules Rules) []flatLeaf {
+	for {
+		if i := indexFlat(leaves, func(l flatLeaf) bool { return l.depth > rules.ExplodeDepth }); i >= 0 {
+			if i > 0 {
+				leaves[i-1].value += leaves[i].value
+			}
+			if i+2 < len(leaves) {
+				leaves[i+2].value += leaves[i+1].value
+			}
+			leaves[i] = flatLeaf{0, leaves[i].depth - 1}
+			leaves = append(leaves[:i+1], leaves[i+2:]...)
+			continue
+		}
+
+		i := indexFlat(leaves, func(l flatLeaf) bool { return l.value > rules.SplitAbove })
+		if i < 0 {
+			return leaves
+		}
+		l := leaves[i]
+		halves := []flatLeaf{{l.value / 2, l.depth + 1}, {l.value - l.value/2, l.depth + 1}}
+		if rules.SplitRounding == RoundLeft {
+			halves[0].value, halves[1].value = halves[1].value, halves[0].value
+		}
+		leaves = append(leaves[:i], append(halves, leaves[i+1:]...)...)
+	}
+}
+
+func indexFlat(leaves []flatLeaf, match func(flatLeaf) bool) int {
+	for i, l := range leaves {
+		if match(l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// readDay18 reads the numbers from the day 18 puzzle input.
+func readDay18(b *testing.B) []*Tree {
+	src, err := os.ReadFile("../../cmd/day18/input.txt")
+	require.NoError(b, err)
+
+	var numbers []*Tree
+	for _, line := range strings.Fields(string(src)) {
+		tree, err := New(line)
+		require.NoError(b, err)
+		numbers = append(numbers, tree)
+	}
+	return numbers
+}
+
+func BenchmarkSum_day18(b *testing.B) {
+	numbers := readDay18(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Sum(numbers...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAdd_day18(b *testing.B) {
+	numbers := readDay18(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x, y := numbers[i%len(numbers)], numbers[(i*7+1)%len(numbers)]
+		if _, err := Add(*x, *y); err != nil {
+			b.Fatal(err)
+		}
+	}
 }